@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mozilla/protodash/audit"
+	"github.com/rs/zerolog/log"
+)
+
+// accessRecord collects what happened to a dashboard request as it passes
+// through the middleware chain, for the audit log.
+type accessRecord struct {
+	user   *User
+	object string
+	reason string
+	denied bool
+}
+
+func accessRecordFromContext(ctx context.Context) *accessRecord {
+	rec, _ := ctx.Value(accessRecordContextKey).(*accessRecord)
+	return rec
+}
+
+// noteAccessReason records why the request was allowed or denied.
+func noteAccessReason(r *http.Request, reason string) {
+	if rec := accessRecordFromContext(r.Context()); rec != nil {
+		rec.reason = reason
+	}
+}
+
+// noteAccessDenied records that the request was denied, for denials that
+// don't respond with 401 or 403 such as redirects to the login page.
+func noteAccessDenied(r *http.Request, reason string) {
+	if rec := accessRecordFromContext(r.Context()); rec != nil {
+		rec.reason = reason
+		rec.denied = true
+	}
+}
+
+// noteAccessObject records the GCS object served for the request.
+func noteAccessObject(r *http.Request, object string) {
+	if rec := accessRecordFromContext(r.Context()); rec != nil {
+		rec.object = object
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// auditAccess sends an audit event for every object served from the
+// dashboard and every denied request.
+func (s *Server) auditAccess(d *Dash) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &accessRecord{}
+			sw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), accessRecordContextKey, rec)))
+
+			decision := audit.Allow
+			if rec.denied || sw.status == http.StatusUnauthorized || sw.status == http.StatusForbidden {
+				decision = audit.Deny
+			}
+			if decision == audit.Allow && rec.object == "" {
+				// redirects between the path and subdomain forms
+				return
+			}
+
+			e := &audit.Event{
+				Time:      time.Now().UTC(),
+				Dashboard: d.Slug,
+				Object:    rec.object,
+				Decision:  decision,
+				Reason:    rec.reason,
+				Status:    sw.status,
+			}
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				e.IP = host
+			}
+			if u := rec.user; u != nil {
+				e.UserID = u.ID
+				e.Email = u.Email
+				e.AuthMethod = u.Method
+				if u.Impersonator != nil {
+					e.Impersonator = u.Impersonator.ID
+				}
+			}
+
+			if err := s.audit.Write(e); err != nil {
+				log.Error().Err(err).Msg("failed to write audit event")
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mozilla/protodash/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditAccess(t *testing.T) {
+	var buf bytes.Buffer
+	s := newTestServer()
+	s.config.OAuthEnabled = true
+	s.audit = audit.NewWriterSink(&buf)
+	d := &Dash{Slug: "report", Groups: []string{"team-a"}}
+
+	serve := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		noteAccessObject(r, "report/index.html")
+	})
+	h := s.auditAccess(d)(s.requireAuth(s.authorize(d)(serve)))
+
+	// allowed
+	r := httptest.NewRequest("GET", "/report/", nil)
+	r.Header.Set("Authorization", "Bearer s3cret")
+	d.Groups = nil
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	// not authenticated
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/report/", nil))
+
+	// not in group
+	d.Groups = []string{"team-a"}
+	r = httptest.NewRequest("GET", "/report/", nil)
+	r.Header.Set("Authorization", "Bearer s3cret")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	var events []audit.Event
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e audit.Event
+		assert.NoError(t, dec.Decode(&e))
+		events = append(events, e)
+	}
+	assert.Len(t, events, 3)
+
+	assert.Equal(t, audit.Allow, events[0].Decision)
+	assert.Equal(t, "token:ci", events[0].UserID)
+	assert.Equal(t, "token", events[0].AuthMethod)
+	assert.Equal(t, "report/index.html", events[0].Object)
+	assert.Equal(t, "authenticated", events[0].Reason)
+
+	assert.Equal(t, audit.Deny, events[1].Decision)
+	assert.Equal(t, http.StatusUnauthorized, events[1].Status)
+	assert.Equal(t, "not authenticated", events[1].Reason)
+	assert.Empty(t, events[1].UserID)
+
+	assert.Equal(t, audit.Deny, events[2].Decision)
+	assert.Equal(t, http.StatusForbidden, events[2].Status)
+	assert.Equal(t, "not a member of an allowed group", events[2].Reason)
+	assert.Equal(t, "report", events[2].Dashboard)
+}
+
+func TestAuditAccessLoginRedirect(t *testing.T) {
+	var buf bytes.Buffer
+	s := newTestServer()
+	s.config.OAuthEnabled = true
+	s.config.RedirectToLogin = true
+	s.audit = audit.NewWriterSink(&buf)
+	d := &Dash{Slug: "report"}
+
+	h := s.auditAccess(d)(s.requireAuth(s.authorize(d)(http.NotFoundHandler())))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/report/", nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	var e audit.Event
+	assert.NoError(t, json.NewDecoder(&buf).Decode(&e))
+	assert.Equal(t, audit.Deny, e.Decision)
+	assert.Equal(t, http.StatusFound, e.Status)
+	assert.Equal(t, "not authenticated", e.Reason)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog/hlog"
+	"github.com/rs/zerolog/log"
+)
+
+// requireAdmin only allows requests with the admin token or from users listed
+// as admins. Admins that are impersonating someone act as themselves here.
+// Admins logged in with the browser can only read: pages of path dashboards
+// are served from the base domain, so their scripts could make any request
+// with the browser's credentials, the way /share is restricted too.
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := bearerToken(r)
+		if s.config.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminToken)) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if s.config.AuthEnabled() {
+			if user, err := s.currentUser(r); err == nil && user != nil && s.isAdmin(user.real()) {
+				if !safeMethod(r.Method) && user.Method != "bearer" && user.Method != "token" {
+					hlog.FromRequest(r).Warn().Str("user", user.real().ID).Msg("rejected admin change without a bearer token")
+					http.Error(w, "Admin Changes Require A Bearer Token", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, setUser(r, user.real()))
+				return
+			}
+		}
+
+		http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// safeMethod returns whether requests with the method only read.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func (s *Server) adminRevokeSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.FormValue("user")
+		if user == "" {
+			http.Error(w, "Missing User", http.StatusBadRequest)
+			return
+		}
+
+		revoker, ok := s.sessionStore.(sessionRevoker)
+		if !ok {
+			http.Error(w, "Session Store Does Not Support Revocation", http.StatusNotImplemented)
+			return
+		}
+
+		n, err := revoker.RevokeUser(user)
+		if err != nil {
+			log.Error().Err(err).Send()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		hlog.FromRequest(r).Info().
+			Str("user", user).
+			Int("revoked", n).
+			Msg("revoked sessions")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"revoked": n})
+	}
+}
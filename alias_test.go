@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAliasRedirects(t *testing.T) {
+	s := newTestServer()
+	dashboards := []*Dash{
+		{Name: "Report", Slug: "report", Public: true, Aliases: []string{"old-report"}, Config: s.config},
+		{Name: "Sub", Slug: "sub", Public: true, Subdomain: true, Aliases: []string{"old-sub"}, Config: s.config},
+	}
+	router := s.routes(dashboards)
+
+	tests := []struct {
+		url      string
+		location string
+	}{
+		{"http://example.com/old-report/", "//example.com/report/"},
+		{"http://example.com/old-report/a/b.html?x=1", "//example.com/report/a/b.html?x=1"},
+		{"http://old-report.example.com/a/b.html", "//example.com/report/a/b.html"},
+		{"http://example.com/old-sub/a?x=1", "//sub.example.com/a?x=1"},
+		{"http://old-sub.example.com/", "//sub.example.com/"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+		assert.Equal(t, http.StatusMovedPermanently, w.Code, tt.url)
+		assert.Equal(t, tt.location, w.Header().Get("Location"), tt.url)
+	}
+}
+
+func TestAliasConflicts(t *testing.T) {
+	files := []configFile{
+		{name: "a.yml", data: []byte("report:\n  aliases: [other, old]\n")},
+		{name: "b.yml", data: []byte("other:\n  aliases: [old]\n")},
+	}
+	_, err := decodeDashboards(files, &Config{DefaultBucket: "protodash"}, nil)
+	assert.Equal(t, []string{
+		"a.yml: dashboard report: alias other is a dashboard defined in b.yml",
+		"b.yml: dashboard other: alias old is already an alias of report",
+	}, errorStrings(err.(configErrors)))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// dashboardEntry describes a dashboard in the catalog API.
+type dashboardEntry struct {
+	Slug        string   `json:"slug"`
+	Name        string   `json:"name"`
+	URL         string   `json:"url"`
+	Visibility  string   `json:"visibility"`
+	Accessible  bool     `json:"accessible"`
+	Description string   `json:"description,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+	Contact     string   `json:"contact,omitempty"`
+	Team        string   `json:"team,omitempty"`
+	Tags        []string `json:"tags"`
+	ExpiresOn   string   `json:"expires_on,omitempty"`
+	UpdatedAt   string   `json:"updated_at,omitempty"`
+	Maintenance bool     `json:"maintenance"`
+}
+
+type dashboardsResponse struct {
+	Dashboards []*dashboardEntry `json:"dashboards"`
+}
+
+// visibility returns who can view the dashboard: "public", "basic_auth" or
+// "private".
+func (d *Dash) visibility() string {
+	switch {
+	case d.Public:
+		return "public"
+	case d.BasicAuth != nil:
+		return "basic_auth"
+	}
+	return "private"
+}
+
+// apiDashboards lists the dashboards as JSON, the same ones as the index page
+// for the user of the request, with the same q, tag and team filters.
+func (s *Server) apiDashboards(dashboards []*Dash) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var user *User
+		if s.config.AuthEnabled() {
+			var err error
+			if user, err = s.currentUser(r); err != nil {
+				if _, ok := s.userBearerToken(r); ok {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				}
+				http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		listed, accessible := s.listDashboards(dashboards, user)
+
+		resp := dashboardsResponse{Dashboards: []*dashboardEntry{}}
+		listed = parseDashboardQuery(r).filter(listed)
+		updated := s.lastUpdated(r.Context(), accessibleDashboards(listed, accessible))
+		for _, d := range listed {
+			entry := &dashboardEntry{
+				Slug:        d.Slug,
+				Name:        d.Name,
+				URL:         requestScheme(r) + ":" + d.url(),
+				Visibility:  d.visibility(),
+				Accessible:  accessible[d.Slug],
+				Description: d.Description,
+				Owner:       d.Owner,
+				Contact:     d.Contact,
+				Team:        d.Team,
+				Tags:        d.Tags,
+				Maintenance: s.maintenanceFor(d) != nil,
+			}
+			if entry.Tags == nil {
+				entry.Tags = []string{}
+			}
+			if !d.ExpiresOn.IsZero() {
+				entry.ExpiresOn = d.ExpiresOn.Format("2006-01-02")
+			}
+			if t, ok := updated[d.Slug]; ok {
+				entry.UpdatedAt = t.UTC().Format(time.RFC3339)
+			}
+			resp.Dashboards = append(resp.Dashboards, entry)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
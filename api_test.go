@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIDashboards(t *testing.T) {
+	s := newTestServer()
+	s.config.OAuthEnabled = true
+	dashboards := []*Dash{
+		{Name: "Public", Slug: "public", Public: true, Tags: []string{"weekly"}, Owner: "Jane Doe", Config: s.config},
+		{Name: "Team", Slug: "team", Groups: []string{"team-a"}, Subdomain: true, Config: s.config},
+		{Name: "Partner", Slug: "partner", BasicAuth: &BasicAuth{}, Config: s.config},
+		{Name: "Old", Slug: "old", Archived: true, Config: s.config},
+		{Name: "Expiring", Slug: "expiring", ExpiresOn: time.Date(2999, 1, 2, 0, 0, 0, 0, time.UTC), Config: s.config},
+	}
+
+	get := func(token string) (int, []*dashboardEntry) {
+		r := httptest.NewRequest("GET", "https://example.com/api/dashboards", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		s.apiDashboards(dashboards).ServeHTTP(w, r)
+
+		var resp dashboardsResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp.Dashboards
+	}
+
+	// the token user isn't in team-a
+	status, entries := get("s3cret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "public", entries[0].Slug)
+	assert.Equal(t, "https://example.com/public/", entries[0].URL)
+	assert.Equal(t, "public", entries[0].Visibility)
+	assert.Equal(t, []string{"weekly"}, entries[0].Tags)
+	assert.Equal(t, "basic_auth", entries[1].Visibility)
+	assert.Equal(t, "2999-01-02", entries[2].ExpiresOn)
+
+	// private dashboards are listed as inaccessible when shown
+	s.config.ShowPrivate = true
+	_, entries = get("")
+	assert.Len(t, entries, 4)
+	assert.Equal(t, "team", entries[1].Slug)
+	assert.Equal(t, "https://team.example.com/", entries[1].URL)
+	assert.False(t, entries[1].Accessible)
+	assert.Equal(t, "private", entries[1].Visibility)
+
+	status, _ = get("invalid")
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Decision is the outcome of an access check.
+type Decision string
+
+const (
+	Allow Decision = "allow"
+	Deny  Decision = "deny"
+)
+
+// Event records a single access to a dashboard.
+type Event struct {
+	Time         time.Time `json:"time"`
+	UserID       string    `json:"user_id,omitempty"`
+	Email        string    `json:"email,omitempty"`
+	Impersonator string    `json:"impersonator,omitempty"`
+	AuthMethod   string    `json:"auth_method,omitempty"`
+	Dashboard    string    `json:"dashboard"`
+	Object       string    `json:"object,omitempty"`
+	Decision     Decision  `json:"decision"`
+	Reason       string    `json:"reason"`
+	Status       int       `json:"status"`
+	IP           string    `json:"ip,omitempty"`
+}
+
+// Sink receives audit events.
+type Sink interface {
+	Write(e *Event) error
+	Close() error
+}
+
+// New returns the sink for target, which is either "stdout", a file path
+// (optionally prefixed with file://) or an http(s) webhook URL.
+func New(target string, client *http.Client) (Sink, error) {
+	switch {
+	case target == "":
+		return Discard, nil
+	case target == "stdout":
+		return NewWriterSink(os.Stdout), nil
+	case strings.HasPrefix(target, "http://"), strings.HasPrefix(target, "https://"):
+		return NewWebhookSink(target, client), nil
+	}
+
+	f, err := os.OpenFile(strings.TrimPrefix(target, "file://"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	return NewWriterSink(f), nil
+}
+
+// Discard is a sink dropping every event.
+var Discard Sink = discard{}
+
+type discard struct{}
+
+func (discard) Write(*Event) error { return nil }
+func (discard) Close() error       { return nil }
+
+// WriterSink writes events as JSON lines.
+type WriterSink struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// NewWriterSink returns a sink writing to w, w is closed with the sink if it
+// is an io.Closer other than stdout.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w, enc: json.NewEncoder(w)}
+}
+
+func (s *WriterSink) Write(e *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(e)
+}
+
+func (s *WriterSink) Close() error {
+	if c, ok := s.w.(io.Closer); ok && s.w != os.Stdout {
+		return c.Close()
+	}
+	return nil
+}
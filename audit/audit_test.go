@@ -0,0 +1,106 @@
+package audit_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mozilla/protodash/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+func event(object string) *audit.Event {
+	return &audit.Event{
+		UserID:    "user-1",
+		Dashboard: "report",
+		Object:    object,
+		Decision:  audit.Allow,
+		Reason:    "authenticated",
+		Status:    http.StatusOK,
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := audit.NewWriterSink(&buf)
+
+	assert.NoError(t, s.Write(event("index.html")))
+	assert.NoError(t, s.Write(event("app.js")))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var e audit.Event
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &e))
+	assert.Equal(t, "index.html", e.Object)
+	assert.Equal(t, audit.Allow, e.Decision)
+}
+
+func TestNewFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	s, err := audit.New("file://"+path, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Write(event("index.html")))
+	assert.NoError(t, s.Close())
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"object":"index.html"`)
+}
+
+func TestWebhookSink(t *testing.T) {
+	var mu sync.Mutex
+	var received []*audit.Event
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var batch []*audit.Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+
+		mu.Lock()
+		received = append(received, batch...)
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	s, err := audit.New(ts.URL, nil)
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, s.Write(event("index.html")))
+	}
+	assert.NoError(t, s.Close())
+
+	assert.Len(t, received, 10)
+	assert.Equal(t, "user-1", received[0].UserID)
+}
+
+func TestWebhookSinkErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	var failed int
+	s := audit.NewWebhookSink(ts.URL, nil)
+	s.OnError = func(err error, events []*audit.Event) {
+		assert.Error(t, err)
+		failed += len(events)
+	}
+
+	assert.NoError(t, s.Write(event("index.html")))
+	assert.NoError(t, s.Close())
+	assert.Equal(t, 1, failed)
+}
@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	webhookQueueSize = 1024
+	webhookBatchSize = 100
+)
+
+// ErrQueueFull is returned when events are produced faster than the webhook
+// accepts them, the event is dropped.
+var ErrQueueFull = errors.New("audit webhook queue is full")
+
+// WebhookSink posts events to a URL as JSON arrays. Events are queued and
+// sent in batches in the background so that a slow webhook doesn't slow
+// down requests.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+	// OnError is called when a batch couldn't be delivered.
+	OnError func(err error, events []*Event)
+
+	queue chan *Event
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+// NewWebhookSink returns a started WebhookSink posting to url.
+func NewWebhookSink(url string, client *http.Client) *WebhookSink {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	s := &WebhookSink{
+		URL:     url,
+		Client:  client,
+		OnError: func(error, []*Event) {},
+		queue:   make(chan *Event, webhookQueueSize),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+func (s *WebhookSink) Write(e *Event) error {
+	select {
+	case s.queue <- e:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting events and waits for the queued ones to be sent.
+func (s *WebhookSink) Close() error {
+	s.once.Do(func() {
+		close(s.queue)
+	})
+	s.wg.Wait()
+	return nil
+}
+
+func (s *WebhookSink) run() {
+	defer s.wg.Done()
+
+	for e := range s.queue {
+		batch := []*Event{e}
+	fill:
+		for len(batch) < webhookBatchSize {
+			select {
+			case e, ok := <-s.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, e)
+			default:
+				break fill
+			}
+		}
+
+		if err := s.send(batch); err != nil {
+			s.OnError(err, batch)
+		}
+	}
+}
+
+func (s *WebhookSink) send(batch []*Event) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Client.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook responded with a %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -6,13 +6,16 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
+	"github.com/mozilla/protodash/pkce"
+	"github.com/rs/zerolog/hlog"
 	"github.com/rs/zerolog/log"
 )
 
 const sessionName = "_protodash_session"
 
-func (s *Server) authLogin() http.HandlerFunc {
+func (s *Server) authLogin(domains map[string]*Dash) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		rt := r.URL.Query().Get("redirect_to")
 
@@ -24,7 +27,7 @@ func (s *Server) authLogin() http.HandlerFunc {
 				return
 			}
 
-			if rtu.Host != "" && rtu.Host != s.config.BaseDomain && !strings.HasSuffix(rtu.Host, "."+s.config.BaseDomain) {
+			if !s.allowedRedirectHost(rtu.Host, domains) {
 				log.Error().Err(fmt.Errorf("invalid hostname %s", rtu.Host))
 				http.Error(w, "Invalid Host", http.StatusInternalServerError)
 				return
@@ -43,9 +46,9 @@ func (s *Server) authLogin() http.HandlerFunc {
 	}
 }
 
-func (s *Server) authCallback() http.HandlerFunc {
+func (s *Server) authCallback(domains map[string]*Dash) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		user, err := gothic.CompleteUserAuth(w, r)
+		user, err := completeUserAuth(w, r)
 		if err != nil {
 			log.Error().Err(err).Send()
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -53,14 +56,19 @@ func (s *Server) authCallback() http.HandlerFunc {
 		}
 
 		session, _ := s.sessionStore.New(r, sessionName)
-		session.Values["current_user_id"] = user.UserID
-		session.Values["current_user_email"] = user.Email
-
 		redirectTo := "//" + s.config.BaseDomain + "/"
-		if val, ok := session.Values["redirect_to"]; ok {
-			delete(session.Values, "redirect_to")
-			redirectTo = val.(string)
+		if val, ok := session.Values["redirect_to"].(string); ok {
+			redirectTo = val
+		}
+
+		if err = s.renewSession(session); err != nil {
+			log.Error().Err(err).Send()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
+		session.Values["current_user_id"] = user.UserID
+		session.Values["current_user_email"] = user.Email
+		session.Values["current_user_groups"] = userGroups(user.RawData[s.config.GroupsClaim])
 
 		if err = session.Save(r, w); err != nil {
 			log.Error().Err(err).Send()
@@ -68,10 +76,54 @@ func (s *Server) authCallback() http.HandlerFunc {
 			return
 		}
 
+		// custom domains don't receive the session cookie, hand it over
+		if rtu, err := url.Parse(redirectTo); err == nil && domains[rtu.Host] != nil {
+			if redirectTo, err = s.handoffURL(rtu, session.Values); err != nil {
+				log.Error().Err(err).Send()
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
 		http.Redirect(w, r, redirectTo, http.StatusFound)
 	}
 }
 
+// completeUserAuth is gothic.CompleteUserAuth with the token exchange and the
+// profile request of the PKCE provider bound to the request context, so that
+// they are cancelled with the request.
+func completeUserAuth(w http.ResponseWriter, r *http.Request) (goth.User, error) {
+	providerName, err := gothic.GetProviderName(r)
+	if err != nil {
+		return goth.User{}, err
+	}
+	provider, err := goth.GetProvider(providerName)
+	if err != nil {
+		return goth.User{}, err
+	}
+	p, ok := provider.(*pkce.Provider)
+	if !ok {
+		return gothic.CompleteUserAuth(w, r)
+	}
+
+	// the flow is over whatever the outcome
+	defer gothic.Logout(w, r)
+
+	value, err := gothic.GetFromSession(providerName, r)
+	if err != nil {
+		return goth.User{}, err
+	}
+	sess, err := p.UnmarshalSession(value)
+	if err != nil {
+		return goth.User{}, err
+	}
+
+	if _, err = sess.(*pkce.Session).AuthorizeContext(r.Context(), p, r.URL.Query()); err != nil {
+		return goth.User{}, err
+	}
+	return p.FetchUserContext(r.Context(), sess)
+}
+
 func (s *Server) authLogout() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		session, _ := s.sessionStore.Get(r, sessionName)
@@ -82,6 +134,12 @@ func (s *Server) authLogout() http.HandlerFunc {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+
+		if s.config.OAuthLogout {
+			http.Redirect(w, r, s.idpLogoutURL(r), http.StatusFound)
+			return
+		}
+
 		http.Redirect(w, r, "//"+s.config.BaseDomain+"/", http.StatusFound)
 	}
 }
@@ -104,24 +162,84 @@ func (s *Server) buildLoginURL(r *http.Request) string {
 	return u.String()
 }
 
-func (s *Server) isLoggedIn(r *http.Request) bool {
+// currentUser returns the user the request is authenticated as, or nil if it
+// is not authenticated. A bearer token takes precedence over the session and
+// an error is returned if it is invalid. With proxy auth only the proxy
+// identity counts.
+func (s *Server) currentUser(r *http.Request) (*User, error) {
+	if token, ok := s.userBearerToken(r); ok {
+		return s.bearerUser(token)
+	}
+
+	if s.proxyAuth != nil {
+		return s.proxyAuth.user(r)
+	}
+
 	session, _ := s.sessionStore.Get(r, sessionName)
-	_, ok := session.Values["current_user_id"]
-	return ok
+	id, ok := session.Values["current_user_id"].(string)
+	if !ok {
+		return nil, nil
+	}
+	email, _ := session.Values["current_user_email"].(string)
+	groups, _ := session.Values["current_user_groups"].([]string)
+
+	user := &User{ID: id, Email: email, Groups: groups, Method: "session"}
+	return s.impersonatedUser(session, user), nil
+}
+
+// userGroups converts a groups claim from the user profile to a list.
+func userGroups(claim interface{}) []string {
+	var groups []string
+	switch v := claim.(type) {
+	case string:
+		groups = append(groups, v)
+	case []interface{}:
+		for _, e := range v {
+			if g, ok := e.(string); ok {
+				groups = append(groups, g)
+			}
+		}
+	}
+	return groups
 }
 
 func (s *Server) requireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if s.isLoggedIn(r) {
+		// already authenticated by a share link
+		if userFromContext(r.Context()) != nil {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		if s.config.RedirectToLogin {
+		user, err := s.currentUser(r)
+		if err != nil {
+			hlog.FromRequest(r).Warn().Err(err).Msg("rejected credentials")
+			noteAccessReason(r, "invalid credentials")
+			if _, ok := s.userBearerToken(r); ok {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			}
+			http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if user != nil {
+			next.ServeHTTP(w, setUser(r, user))
+			return
+		}
+
+		noteAccessDenied(r, "not authenticated")
+
+		if s.config.OAuthEnabled && s.config.RedirectToLogin {
 			http.Redirect(w, r, s.buildLoginURL(r), http.StatusFound)
 			return
 		}
 
-		http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+		// offer browsers to log in
+		if s.config.OAuthEnabled && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			s.renderPage(w, http.StatusUnauthorized, "login.gohtml", struct{ LoginURL string }{s.buildLoginURL(r)})
+			return
+		}
+
+		s.renderError(w, r, http.StatusUnauthorized)
 	})
 }
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/markbates/goth"
+	"github.com/markbates/goth/gothic"
+	"github.com/mozilla/protodash/audit"
+	"github.com/mozilla/protodash/pkce"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer() *Server {
+	cfg := &Config{
+		BaseDomain: "example.com",
+		APITokens:  map[string]string{"ci": "s3cret"},
+	}
+	tmpl, err := loadTemplates("", cfg.BaseDomain)
+	if err != nil {
+		panic(err)
+	}
+	return &Server{
+		config:       cfg,
+		sessionStore: sessions.NewCookieStore([]byte("secret")),
+		audit:        audit.Discard,
+		tmpl:         tmpl,
+	}
+}
+
+func echoUser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u := userFromContext(r.Context()); u != nil {
+			w.Write([]byte(u.ID))
+		}
+	})
+}
+
+func TestRequireAuthAPIToken(t *testing.T) {
+	s := newTestServer()
+	h := s.requireAuth(echoUser())
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "token:ci", w.Body.String())
+}
+
+func TestRequireAuthInvalidBearer(t *testing.T) {
+	s := newTestServer()
+	s.config.RedirectToLogin = true
+	h := s.requireAuth(echoUser())
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer wrong")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), "invalid_token")
+}
+
+func TestRequireAuthSession(t *testing.T) {
+	s := newTestServer()
+	h := s.requireAuth(echoUser())
+
+	// no session
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// logged in session
+	w = httptest.NewRecorder()
+	session, _ := s.sessionStore.New(r, sessionName)
+	session.Values["current_user_id"] = "user-1"
+	assert.NoError(t, session.Save(r, w))
+
+	r = httptest.NewRequest("GET", "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user-1", w.Body.String())
+}
+
+func TestRequireAuthProxyHeader(t *testing.T) {
+	s := newTestServer()
+	s.config.ProxyAuth = proxyAuthHeader
+	s.config.ProxyAuthUserHeader = "X-Forwarded-User"
+	s.config.ProxyAuthTrustedCIDRs = []string{"10.0.0.0/8"}
+
+	var err error
+	s.proxyAuth, err = newProxyAuth(s.config)
+	assert.NoError(t, err)
+	h := s.requireAuth(echoUser())
+
+	tests := []struct {
+		remoteAddr string
+		email      string
+		status     int
+		body       string
+	}{
+		{"10.1.2.3:1234", "user@example.com", http.StatusOK, "user@example.com"},
+		{"192.168.1.1:1234", "user@example.com", http.StatusUnauthorized, ""},
+		{"10.1.2.3:1234", "", http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.email != "" {
+			r.Header.Set("X-Forwarded-Email", tt.email)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		assert.Equal(t, tt.status, w.Code)
+		if tt.status == http.StatusOK {
+			assert.Equal(t, tt.body, w.Body.String())
+		}
+	}
+
+	// the Authorization header of the proxy doesn't override its identity
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.1.2.3:1234"
+	r.Header.Set("X-Forwarded-Email", "user@example.com")
+	r.Header.Set("Authorization", "Bearer proxy-token")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user@example.com", w.Body.String())
+}
+
+func TestNewProxyAuthAssertionRequiresAudience(t *testing.T) {
+	cfg := &Config{ProxyAuth: proxyAuthAssertion}
+	_, err := newProxyAuth(cfg)
+	assert.EqualError(t, err, `proxy auth mode "assertion" requires an audience`)
+
+	cfg.ProxyAuthAudience = "/projects/1/global/backendServices/2"
+	_, err = newProxyAuth(cfg)
+	assert.NoError(t, err)
+}
+
+func TestNewBearerVerifierRequiresAudience(t *testing.T) {
+	cfg := &Config{BearerIssuer: "https://auth.example.com/"}
+	_, err := newBearerVerifier(cfg)
+	assert.EqualError(t, err, "bearer issuer https://auth.example.com/ requires an audience")
+
+	cfg.BearerAudience = "https://protodash.example.com/"
+	v, err := newBearerVerifier(cfg)
+	assert.NoError(t, err)
+	assert.NotNil(t, v)
+}
+
+func TestCompleteUserAuthUsesRequestContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/token" {
+			w.Write([]byte(`{"access_token":"token","token_type":"Bearer","expires_in":3600}`))
+			return
+		}
+		w.Write([]byte(`{"user_id":"user-1","email":"user@example.com"}`))
+	}))
+	defer ts.Close()
+
+	p := pkce.New("client", "http://example.com/auth/callback", "auth.example.com",
+		pkce.WithEndpoints(ts.URL+"/authorize", ts.URL+"/token", ts.URL+"/userinfo"),
+		pkce.WithScopes("profile"),
+	)
+	goth.UseProviders(p)
+	defer goth.ClearProviders()
+	getProviderName, store := gothic.GetProviderName, gothic.Store
+	defer func() { gothic.GetProviderName, gothic.Store = getProviderName, store }()
+	gothic.GetProviderName = func(*http.Request) (string, error) { return p.Name(), nil }
+	gothic.Store = sessions.NewCookieStore([]byte("secret"))
+
+	callback := func(ctx context.Context) (goth.User, error) {
+		sess, err := p.BeginAuth("state")
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		assert.NoError(t, gothic.StoreInSession(p.Name(), sess.Marshal(), httptest.NewRequest("GET", "/", nil), w))
+
+		r := httptest.NewRequest("GET", "/auth/callback?code=code&state=state", nil).WithContext(ctx)
+		r = withCookies(r, w.Result().Cookies())
+		return completeUserAuth(httptest.NewRecorder(), r)
+	}
+
+	user, err := callback(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "user@example.com", user.Email)
+
+	// the token exchange stops with the request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = callback(ctx)
+	assert.True(t, errors.Is(err, context.Canceled), err)
+}
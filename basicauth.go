@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BasicAuth protects a dashboard with HTTP basic auth, using either a shared
+// password (any username is accepted) or htpasswd style bcrypt credentials.
+// Secrets are referenced with ${VAR} or secret:// so they never end up in the
+// config file.
+type BasicAuth struct {
+	Password string   `yaml:"password" doc:"Shared password, any username is accepted. Use a ${VAR} or secret:// reference to keep it out of the config"`
+	Users    []string `yaml:"users" doc:"htpasswd style user:bcrypt-hash credentials, each entry can hold several comma or newline separated ones"`
+
+	password string
+	users    map[string][]byte
+	verified sync.Map
+}
+
+// validate returns the problems of the config that can be found without
+// resolving its secrets.
+func (b *BasicAuth) validate() []string {
+	var problems []string
+	if b.Password == "" && len(b.Users) == 0 {
+		problems = append(problems, "basic_auth requires password or users")
+	}
+	for _, line := range b.Users {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if hasReference(line) {
+			continue
+		}
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], "$2") {
+			problems = append(problems, fmt.Sprintf("basic_auth user %q must be user:bcrypt-hash", parts[0]))
+		}
+	}
+	return problems
+}
+
+// load resolves the secrets referenced by the config.
+func (b *BasicAuth) load() error {
+	b.password = b.Password
+
+	// a reference can hold several credentials
+	var lines []string
+	for _, entry := range b.Users {
+		lines = append(lines, strings.FieldsFunc(entry, func(r rune) bool {
+			return r == '\n' || r == ','
+		})...)
+	}
+
+	b.users = make(map[string][]byte, len(lines))
+	for _, line := range lines {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], "$2") {
+			return fmt.Errorf("invalid basic auth user %q, expected user:bcrypt-hash", parts[0])
+		}
+		b.users[parts[0]] = []byte(parts[1])
+	}
+
+	if b.password == "" && len(b.users) == 0 {
+		return fmt.Errorf("basic auth requires a password or users")
+	}
+
+	return nil
+}
+
+// check returns whether the credentials are valid. Successful bcrypt checks
+// are remembered so that every asset of a dashboard doesn't pay for one.
+func (b *BasicAuth) check(username, password string) bool {
+	if b.password != "" && subtle.ConstantTimeCompare([]byte(password), []byte(b.password)) == 1 {
+		return true
+	}
+
+	hash, ok := b.users[username]
+	if !ok {
+		return false
+	}
+
+	key := sha256.Sum256([]byte(username + "\x00" + password + "\x00" + string(hash)))
+	if _, ok := b.verified.Load(key); ok {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return false
+	}
+	b.verified.Store(key, struct{}{})
+	return true
+}
+
+// requireBasicAuth only allows requests with valid basic auth credentials for
+// the dashboard, or users authenticated with the global auth when enabled.
+func (s *Server) requireBasicAuth(d *Dash) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// already authenticated by a share link
+			if userFromContext(r.Context()) != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if username, password, ok := r.BasicAuth(); ok && d.BasicAuth.check(username, password) {
+				user := &User{ID: "basic:" + username, Method: "basic"}
+				next.ServeHTTP(w, setUser(r, user))
+				return
+			}
+
+			if s.config.AuthEnabled() {
+				if user, err := s.currentUser(r); err == nil && user != nil {
+					next.ServeHTTP(w, setUser(r, user))
+					return
+				}
+			}
+
+			noteAccessReason(r, "invalid basic auth credentials")
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", d.Name))
+			http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBasicAuthLoad(t *testing.T) {
+	b := &BasicAuth{Users: []string{"alice:plaintext"}}
+	assert.Error(t, b.load())
+
+	b = &BasicAuth{}
+	assert.Error(t, b.load())
+}
+
+func TestRequireBasicAuth(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("alices-password"), bcrypt.MinCost)
+	bobHash, _ := bcrypt.GenerateFromPassword([]byte("bobs-password"), bcrypt.MinCost)
+	d := &Dash{
+		Name: "Partner Report",
+		BasicAuth: &BasicAuth{
+			Password: "shared",
+			// as resolved from a reference holding several credentials
+			Users: []string{"alice:" + string(hash) + "\nbob:" + string(bobHash) + "\n"},
+		},
+	}
+	assert.NoError(t, d.BasicAuth.load())
+
+	s := newTestServer()
+	h := s.requireBasicAuth(d)(echoUser())
+
+	tests := []struct {
+		username string
+		password string
+		status   int
+	}{
+		{"anyone", "shared", http.StatusOK},
+		{"alice", "alices-password", http.StatusOK},
+		{"alice", "alices-password", http.StatusOK},
+		{"alice", "wrong", http.StatusUnauthorized},
+		{"bob", "bobs-password", http.StatusOK},
+		{"bob", "alices-password", http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.username != "" {
+			r.SetBasicAuth(tt.username, tt.password)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		assert.Equal(t, tt.status, w.Code, tt.username)
+		if tt.status == http.StatusUnauthorized {
+			assert.Contains(t, w.Header().Get("WWW-Authenticate"), `realm="Partner Report"`)
+		} else {
+			assert.Equal(t, "basic:"+tt.username, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mozilla/protodash/jwt"
+)
+
+var errInvalidBearerToken = errors.New("invalid bearer token")
+
+// newBearerVerifier returns a verifier for bearer JWTs issued by the
+// configured issuer, or nil if bearer JWTs are not enabled. An audience is
+// required, otherwise tokens the issuer made for any other API would do.
+func newBearerVerifier(cfg *Config) (*jwt.Verifier, error) {
+	if cfg.BearerIssuer == "" {
+		return nil, nil
+	}
+	if cfg.BearerAudience == "" {
+		return nil, fmt.Errorf("bearer issuer %s requires an audience", cfg.BearerIssuer)
+	}
+
+	jwksURL := cfg.BearerJWKSURL
+	if jwksURL == "" {
+		jwksURL = strings.TrimSuffix(cfg.BearerIssuer, "/") + "/.well-known/jwks.json"
+	}
+
+	keys := jwt.NewRemoteKeySet(jwksURL, &http.Client{Timeout: cfg.ClientTimeout})
+	return jwt.NewVerifier(keys, cfg.BearerIssuer, cfg.BearerAudience), nil
+}
+
+// bearerToken returns the token from the Authorization header of the request.
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(h[7:]), true
+}
+
+// userBearerToken returns the bearer token identifying the user of the
+// request. With proxy auth the proxy identifies users, and the Authorization
+// header may well be its own, so it is ignored.
+func (s *Server) userBearerToken(r *http.Request) (string, bool) {
+	if s.proxyAuth != nil {
+		return "", false
+	}
+	return bearerToken(r)
+}
+
+// bearerUser authenticates a bearer token, either one of the static API
+// tokens or a JWT signed by the configured issuer.
+func (s *Server) bearerUser(token string) (*User, error) {
+	for name, apiToken := range s.config.APITokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) == 1 {
+			return &User{ID: "token:" + name, Method: "token"}, nil
+		}
+	}
+
+	if s.bearerVerifier == nil {
+		return nil, errInvalidBearerToken
+	}
+
+	claims, err := s.bearerVerifier.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &User{
+		ID:     claims.Subject(),
+		Email:  claims.String("email"),
+		Groups: claims.Strings(s.config.GroupsClaim),
+		Method: "bearer",
+	}, nil
+}
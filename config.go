@@ -22,16 +22,59 @@ type Config struct {
 	MaxIdleConns    int           `split_words:"true" default:"10"`
 	BaseDomain      string        `split_words:"true" default:"localhost:8080"`
 
-	OAuthEnabled      bool   `envconfig:"OAUTH_ENABLED"`
-	OAuthDomain       string `envconfig:"OAUTH_DOMAIN"`
-	OAuthClientID     string `envconfig:"OAUTH_CLIENT_ID"`
-	OAuthClientSecret string `envconfig:"OAUTH_CLIENT_SECRET"`
-	OAuthRedirectURI  string `envconfig:"OAUTH_REDIRECT_URI"`
-	SessionSecret     string `split_words:"true"`
-	ShowPrivate       bool   `split_words:"true"`
-	RedirectToLogin   bool   `split_words:"true"`
-	DefaultBucket     string `split_words:"true"`
-	ConfigFile        string `split_words:"true" default:"config.yml"`
+	OAuthEnabled           bool              `envconfig:"OAUTH_ENABLED"`
+	OAuthDomain            string            `envconfig:"OAUTH_DOMAIN"`
+	OAuthClientID          string            `envconfig:"OAUTH_CLIENT_ID"`
+	OAuthClientSecret      string            `envconfig:"OAUTH_CLIENT_SECRET"`
+	OAuthRedirectURI       string            `envconfig:"OAUTH_REDIRECT_URI"`
+	OAuthAuthParams        map[string]string `envconfig:"OAUTH_AUTH_PARAMS"`
+	OAuthFlowTimeout       time.Duration     `envconfig:"OAUTH_FLOW_TIMEOUT" default:"10m"`
+	OAuthLogout            bool              `envconfig:"OAUTH_LOGOUT"`
+	OAuthLogoutURL         string            `envconfig:"OAUTH_LOGOUT_URL"`
+	OAuthBackchannelLogout bool              `envconfig:"OAUTH_BACKCHANNEL_LOGOUT"`
+	BearerIssuer           string            `split_words:"true"`
+	BearerAudience         string            `split_words:"true"`
+	BearerJWKSURL          string            `envconfig:"BEARER_JWKS_URL"`
+	APITokens              map[string]string `envconfig:"API_TOKENS"`
+	ProxyAuth              string            `split_words:"true"`
+	ProxyAuthHeader        string            `split_words:"true"`
+	ProxyAuthUserHeader    string            `split_words:"true" default:"X-Forwarded-User"`
+	ProxyAuthGroupsHeader  string            `split_words:"true" default:"X-Forwarded-Groups"`
+	ProxyAuthIssuer        string            `split_words:"true" default:"https://cloud.google.com/iap"`
+	ProxyAuthAudience      string            `split_words:"true"`
+	ProxyAuthJWKSURL       string            `envconfig:"PROXY_AUTH_JWKS_URL" default:"https://www.gstatic.com/iap/verify/public_key-jwk"`
+	ProxyAuthTrustedCIDRs  []string          `envconfig:"PROXY_AUTH_TRUSTED_CIDRS"`
+	SessionSecret          string            `split_words:"true"`
+	SessionStore           string            `split_words:"true" default:"cookie"`
+	SessionStorePath       string            `split_words:"true" default:"sessions.db"`
+	SessionRedisURL        string            `split_words:"true" default:"redis://localhost:6379/0"`
+	Admins                 []string          `envconfig:"ADMINS"`
+	ImpersonationTTL       time.Duration     `split_words:"true" default:"30m"`
+	GroupsClaim            string            `split_words:"true" default:"groups"`
+	AuditSink              string            `split_words:"true"`
+	AdminToken             string            `split_words:"true"`
+	ShareSecret            string            `split_words:"true"`
+	ShareMaxTTL            time.Duration     `split_words:"true" default:"720h"`
+	ShowPrivate            bool              `split_words:"true"`
+	RedirectToLogin        bool              `split_words:"true"`
+	DefaultBucket          string            `split_words:"true"`
+	ConfigFile             string            `split_words:"true" default:"config.yml"`
+	ConfigReloadInterval   time.Duration     `split_words:"true" default:"10s"`
+	SecretsDir             string            `split_words:"true" default:"/etc/protodash/secrets"`
+	ExpiryWarning          time.Duration     `split_words:"true" default:"720h"`
+	ExpiryGracePeriod      time.Duration     `split_words:"true" default:"336h"`
+	Maintenance            bool              `split_words:"true"`
+	MaintenanceMessage     string            `split_words:"true"`
+	MaintenanceRetryAfter  time.Duration     `split_words:"true" default:"5m"`
+	LastUpdatedTTL         time.Duration     `envconfig:"LAST_UPDATED_TTL" default:"10m"`
+	LastUpdatedFromPrefix  bool              `envconfig:"LAST_UPDATED_FROM_PREFIX"`
+	TemplateDir            string            `split_words:"true"`
+}
+
+// AuthEnabled returns whether private dashboards require authentication,
+// either through OAuth or an authenticating proxy.
+func (c *Config) AuthEnabled() bool {
+	return c.OAuthEnabled || c.ProxyAuth != ""
 }
 
 // HTTPClient returns an HTTP client with the proper authentication config
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errNotModified is returned by config sources when the config didn't change
+// since the version that was asked for.
+var errNotModified = errors.New("config not modified")
+
+// configFile is a file holding the config of one or more dashboards.
+type configFile struct {
+	name string
+	data []byte
+}
+
+// configSource fetches the dashboard config. Versions are opaque strings
+// identifying the content of the config, an empty version always fetches it.
+type configSource interface {
+	fetch(version string) (files []configFile, newVersion string, err error)
+	String() string
+}
+
+// newConfigSource returns the source for name, which is either a local path,
+// a gs://bucket/object URL fetched with the GCS client or an http(s) URL.
+func newConfigSource(name string, gcs *http.Client, client *http.Client) configSource {
+	switch {
+	case strings.HasPrefix(name, "gs://"):
+		bucket, object := splitGCSURL(name)
+		u := &url.URL{Scheme: "https", Host: gcsHost, Path: "/" + bucket + "/" + object}
+		return &httpSource{url: u.String(), name: name, client: gcs}
+	case strings.HasPrefix(name, "http://"), strings.HasPrefix(name, "https://"):
+		return &httpSource{url: name, name: name, client: client}
+	}
+	return &fileSource{name: name}
+}
+
+func splitGCSURL(name string) (bucket, object string) {
+	parts := strings.SplitN(strings.TrimPrefix(name, "gs://"), "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// fileSource reads the config from a local file, or from every *.yml and
+// *.yaml file of a directory. Files are identified by their modification time
+// and size, Stat follows symlinks so that the atomic swaps of mounted
+// Kubernetes config maps are noticed.
+type fileSource struct {
+	name string
+}
+
+func (s *fileSource) fetch(version string) ([]configFile, string, error) {
+	fi, err := os.Stat(s.name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	infos := []os.FileInfo{fi}
+	names := []string{s.name}
+	if fi.IsDir() {
+		infos, names, err = configDirFiles(s.name)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	h := sha256.New()
+	for i, fi := range infos {
+		fmt.Fprintf(h, "%s %d %d\n", names[i], fi.ModTime().UnixNano(), fi.Size())
+	}
+	newVersion := hex.EncodeToString(h.Sum(nil))
+	if newVersion == version {
+		return nil, version, errNotModified
+	}
+
+	files := make([]configFile, len(names))
+	for i, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, "", err
+		}
+		files[i] = configFile{name: name, data: data}
+	}
+	return files, newVersion, nil
+}
+
+// configDirFiles lists the config files of a directory sorted by name.
+func configDirFiles(dir string) ([]os.FileInfo, []string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var infos []os.FileInfo
+	var names []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if ext != ".yml" && ext != ".yaml" || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		name := filepath.Join(dir, entry.Name())
+		// entries are symlinks in mounted config maps
+		fi, err := os.Stat(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if fi.IsDir() {
+			continue
+		}
+		infos = append(infos, fi)
+		names = append(names, name)
+	}
+	return infos, names, nil
+}
+
+func (s *fileSource) String() string {
+	return s.name
+}
+
+// httpSource downloads the config, using the ETag of the response to check
+// whether it changed. Servers that don't send an ETag are compared by the
+// hash of the config.
+type httpSource struct {
+	url    string
+	name   string
+	client *http.Client
+}
+
+func (s *httpSource) fetch(version string) ([]configFile, string, error) {
+	req, err := http.NewRequest("GET", s.url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if strings.HasPrefix(version, `"`) || strings.HasPrefix(version, `W/"`) {
+		req.Header.Set("If-None-Match", version)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, version, errNotModified
+	default:
+		return nil, "", fmt.Errorf("fetching %s: unexpected status %d", s.name, resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("fetching %s: %w", s.name, err)
+	}
+
+	newVersion := resp.Header.Get("ETag")
+	if newVersion == "" {
+		sum := sha256.Sum256(data)
+		newVersion = hex.EncodeToString(sum[:])
+	}
+	if newVersion == version {
+		return nil, version, errNotModified
+	}
+	return []configFile{{name: s.name, data: data}}, newVersion, nil
+}
+
+func (s *httpSource) String() string {
+	return s.name
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "protodash")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "config.yml")
+	assert.NoError(t, ioutil.WriteFile(name, []byte("report: {}\n"), 0644))
+
+	src := newConfigSource(name, nil, nil)
+	data, version, err := src.fetch("")
+	assert.NoError(t, err)
+	assert.Equal(t, "report: {}\n", string(data[0].data))
+
+	_, _, err = src.fetch(version)
+	assert.Equal(t, errNotModified, err)
+
+	assert.NoError(t, ioutil.WriteFile(name, []byte("report: {}\nother: {}\n"), 0644))
+	data, _, err = src.fetch(version)
+	assert.NoError(t, err)
+	assert.Equal(t, "report: {}\nother: {}\n", string(data[0].data))
+}
+
+func TestHTTPSource(t *testing.T) {
+	config := "report: {}\n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"%d"`, len(config))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(config))
+	}))
+	defer ts.Close()
+
+	src := newConfigSource(ts.URL+"/config.yml", nil, ts.Client())
+	data, version, err := src.fetch("")
+	assert.NoError(t, err)
+	assert.Equal(t, config, string(data[0].data))
+
+	_, _, err = src.fetch(version)
+	assert.Equal(t, errNotModified, err)
+
+	config = "report: {}\nother: {}\n"
+	data, _, err = src.fetch(version)
+	assert.NoError(t, err)
+	assert.Equal(t, config, string(data[0].data))
+}
+
+func TestGCSSource(t *testing.T) {
+	src := newConfigSource("gs://protodash-config/prod/config.yml", http.DefaultClient, nil)
+	assert.Equal(t, "https://storage.googleapis.com/protodash-config/prod/config.yml", src.(*httpSource).url)
+}
+
+func TestDirSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "protodash")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.yml"), []byte("report: {}\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.yaml"), []byte("other: {}\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("# config\n"), 0644))
+
+	src := newConfigSource(dir, nil, nil)
+	files, version, err := src.fetch("")
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	assert.Equal(t, filepath.Join(dir, "a.yaml"), files[0].name)
+
+	_, _, err = src.fetch(version)
+	assert.Equal(t, errNotModified, err)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "c.yml"), []byte("third: {}\n"), 0644))
+	files, _, err = src.fetch(version)
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+}
+
+func TestParseDashboardsDuplicates(t *testing.T) {
+	files := []configFile{
+		{name: "a.yml", data: []byte("report: {}\n")},
+		{name: "b.yml", data: []byte("other: {}\nreport: {}\n")},
+	}
+	_, err := parseDashboards(files, &Config{DefaultBucket: "protodash"}, nil, nil)
+	assert.EqualError(t, err, "b.yml: dashboard report is already defined in a.yml")
+
+	_, err = parseDashboards(files[1:], &Config{DefaultBucket: "protodash"}, nil, nil)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+var errCrossOrigin = errors.New("request does not come from the base domain")
+
+// checkOrigin returns an error unless the request comes from a page of the
+// base domain, per its Origin or Referer header. Pages of path dashboards are
+// served from the base domain too, so this only keeps other sites and
+// subdomains out: anything riskier than ending an impersonation requires a
+// bearer token.
+func (s *Server) checkOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	o, err := url.Parse(origin)
+	if err != nil || o.Host != s.config.BaseDomain {
+		return errCrossOrigin
+	}
+	return nil
+}
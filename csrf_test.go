@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminChangesRequireBearerToken(t *testing.T) {
+	s := newTestServer()
+	s.config.OAuthEnabled = true
+	s.config.Admins = []string{"admin@example.com"}
+	s.config.AdminToken = "admin-token"
+
+	admin := loginCookies(t, s, map[interface{}]interface{}{
+		"current_user_id":    "admin-1",
+		"current_user_email": "admin@example.com",
+	})
+	h := s.requireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// logged in admins can read but not change anything, even from the base
+	// domain where dashboard scripts run too
+	r := withCookies(httptest.NewRequest("GET", "/admin/maintenance", nil), admin)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	r = withCookies(httptest.NewRequest("POST", "/admin/maintenance", nil), admin)
+	r.Header.Set("Origin", "https://example.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// bearer tokens aren't sent by browsers on their own
+	r = httptest.NewRequest("POST", "/admin/maintenance", nil)
+	r.Header.Set("Authorization", "Bearer admin-token")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestCheckOrigin(t *testing.T) {
+	s := newTestServer()
+
+	tests := []struct {
+		origin  string
+		referer string
+		err     error
+	}{
+		{"https://example.com", "", nil},
+		{"", "https://example.com/", nil},
+		{"", "", errCrossOrigin},
+		{"https://report.example.com", "", errCrossOrigin},
+		{"https://evil.example.org", "https://example.com/", errCrossOrigin},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/admin/impersonate/stop", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.referer != "" {
+			r.Header.Set("Referer", tt.referer)
+		}
+		assert.Equal(t, tt.err, s.checkOrigin(r), tt)
+	}
+}
@@ -3,28 +3,77 @@ package main
 import (
 	"context"
 	"fmt"
+	"html/template"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog/hlog"
 )
 
 // Dash is an instance of a specific dashboard
 type Dash struct {
-	Name      string
-	Slug      string
-	Bucket    string `yaml:"gcs_bucket"`
-	SPA       bool   `yaml:"single_page_app"`
-	Prefix    string
-	Public    bool
-	Subdomain bool
-	Config    *Config
-	Client    *http.Client
+	Name      string     `yaml:"-"`
+	Slug      string     `yaml:"-"`
+	Bucket    string     `yaml:"gcs_bucket" doc:"GCS bucket holding the dashboard files, defaults to PROTODASH_DEFAULT_BUCKET"`
+	SPA       bool       `yaml:"single_page_app" doc:"Serve index.html for paths that don't exist in the bucket"`
+	Prefix    string     `doc:"Directory of the bucket holding the dashboard files, without leading or trailing slash"`
+	Public    bool       `doc:"Serve the dashboard without authentication"`
+	Subdomain bool       `doc:"Serve the dashboard from <slug>.<base domain> instead of /<slug>/"`
+	BasicAuth *BasicAuth `yaml:"basic_auth" doc:"Require HTTP basic auth credentials to view the dashboard"`
+	Groups    []string   `doc:"Groups allowed to view the dashboard, every authenticated user if empty"`
+	Aliases   []string   `doc:"Previous slugs of the dashboard, redirected to the current one"`
+	Domains   []string   `doc:"Custom hostnames the dashboard is also served on"`
+
+	Title       string   `doc:"Name shown on the index page, derived from the slug if empty"`
+	Description string   `doc:"What the dashboard shows"`
+	Owner       string   `doc:"Person responsible for the dashboard"`
+	Contact     string   `doc:"Email address or URL to reach the owner"`
+	Team        string   `doc:"Team the dashboard belongs to"`
+	Tags        []string `doc:"Keywords describing the dashboard"`
+
+	ExpiresOn time.Time `yaml:"expires_on" doc:"Last day the dashboard is served normally, afterwards a notice is shown until the grace period ends"`
+	Archived  bool      `doc:"Stop serving the dashboard, requests get a 410 Gone pointing to the owner"`
+
+	Maintenance        bool   `doc:"Answer with 503 Service Unavailable, except for admins"`
+	MaintenanceMessage string `yaml:"maintenance_message" doc:"Message shown while the dashboard is in maintenance"`
+
+	Config    *Config            `yaml:"-"`
+	Client    *http.Client       `yaml:"-"`
+	Templates *template.Template `yaml:"-"`
+
+	// file is the config file the dashboard is defined in
+	file string
 }
 
 const gcsHost = "storage.googleapis.com"
 
+func (d *Dash) hasDomain(host string) bool {
+	for _, domain := range d.Domains {
+		if domain == host {
+			return true
+		}
+	}
+	return false
+}
+
+// url returns the protocol relative URL of the root of the dashboard.
+func (d *Dash) url() string {
+	if d.Subdomain {
+		return "//" + d.Slug + "." + d.Config.BaseDomain + "/"
+	}
+	return "//" + d.Config.BaseDomain + "/" + d.Slug + "/"
+}
+
+// ContactURL returns a link to the contact of the dashboard.
+func (d *Dash) ContactURL() string {
+	if strings.Contains(d.Contact, "@") && !strings.Contains(d.Contact, "://") {
+		return "mailto:" + d.Contact
+	}
+	return d.Contact
+}
+
 func (d *Dash) getObject(ctx context.Context, headers http.Header, method, key string) (*http.Response, error) {
 	// build up the GCS URL
 	url := fmt.Sprintf("https://%s.%s/%s", d.Bucket, gcsHost, key)
@@ -41,6 +90,16 @@ func (d *Dash) getObject(ctx context.Context, headers http.Header, method, key s
 
 }
 
+// relPath returns the path of the request relative to the root of the
+// dashboard, for both the path and subdomain forms of its URL.
+func (d *Dash) relPath(r *http.Request) string {
+	p := strings.TrimPrefix(r.URL.Path, "/")
+	if r.Host != d.Slug+"."+d.Config.BaseDomain && !d.hasDomain(r.Host) {
+		p = strings.TrimPrefix(p, d.Slug+"/")
+	}
+	return p
+}
+
 func (d *Dash) Handler(prefix string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -82,13 +141,26 @@ func (d *Dash) Handler(prefix string) http.HandlerFunc {
 
 		defer gcsResp.Body.Close()
 
+		noteAccessObject(r, objName)
+
 		// add dashboard name, bucket, and object to log
 		hlog.FromRequest(r).Info().
 			Str("dashboard", d.Name).
+			Str("slug", d.Slug).
+			Str("owner", d.Owner).
+			Str("team", d.Team).
 			Str("bucket", d.Bucket).
 			Str("object", objName).
 			Msg("")
 
+		// mark responses served to an impersonated user
+		if user := userFromContext(r.Context()); user != nil && user.Impersonator != nil {
+			if err = addImpersonationBanner(r, gcsResp, user, d.Templates); err != nil {
+				http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
 		// copy GCS response headers and body to our response
 		for name, values := range gcsResp.Header {
 			for _, value := range values {
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/rs/zerolog/hlog"
+	"github.com/rs/zerolog/log"
+)
+
+// handoffPath is where custom domains receive the session of a user that
+// logged in on the base domain, the session cookie of the base domain isn't
+// sent to them.
+const handoffPath = "/.protodash/handoff"
+
+// handoffTTL bounds how long a handoff token can be used after login.
+const handoffTTL = time.Minute
+
+// handoff is the session handed to a custom domain.
+type handoff struct {
+	Host   string
+	ID     string
+	Email  string
+	Groups []string
+	// Nonce makes the handoff single-use
+	Nonce string
+}
+
+// usedNonces remembers the nonces of single-use tokens while the tokens are
+// valid, so that a leaked token can't be replayed.
+type usedNonces struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+// use records the nonce of a token valid for ttl and returns whether it was
+// unused.
+func (u *usedNonces) use(nonce string, ttl time.Duration, now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.nonces == nil {
+		u.nonces = make(map[string]time.Time)
+	}
+	for n, expires := range u.nonces {
+		if now.After(expires) {
+			delete(u.nonces, n)
+		}
+	}
+
+	if _, ok := u.nonces[nonce]; ok {
+		return false
+	}
+	u.nonces[nonce] = now.Add(ttl)
+	return true
+}
+
+// customDomains maps the custom domains of the dashboards to their dashboard.
+func customDomains(dashboards []*Dash) map[string]*Dash {
+	domains := make(map[string]*Dash)
+	for _, d := range dashboards {
+		for _, domain := range d.Domains {
+			domains[domain] = d
+		}
+	}
+	return domains
+}
+
+// allowedRedirectHost returns whether users can be sent back to host after
+// logging in.
+func (s *Server) allowedRedirectHost(host string, domains map[string]*Dash) bool {
+	return host == "" ||
+		host == s.config.BaseDomain ||
+		strings.HasSuffix(host, "."+s.config.BaseDomain) ||
+		domains[host] != nil
+}
+
+// handoffCodec signs and encrypts handoff tokens, with keys derived from the
+// session secret.
+func (s *Server) handoffCodec() *securecookie.SecureCookie {
+	hashKey := sha256.Sum256([]byte("protodash handoff\x00" + s.config.SessionSecret))
+	blockKey := sha256.Sum256([]byte("protodash handoff encryption\x00" + s.config.SessionSecret))
+	codec := securecookie.New(hashKey[:], blockKey[:])
+	codec.MaxAge(int(handoffTTL / time.Second))
+	return codec
+}
+
+// handoffURL returns the URL passing the session to the custom domain of
+// redirectTo, which the user is then sent to.
+func (s *Server) handoffURL(redirectTo *url.URL, values map[interface{}]interface{}) (string, error) {
+	h := &handoff{
+		Host:  redirectTo.Host,
+		Nonce: base64.RawURLEncoding.EncodeToString(securecookie.GenerateRandomKey(16)),
+	}
+	h.ID, _ = values["current_user_id"].(string)
+	h.Email, _ = values["current_user_email"].(string)
+	h.Groups, _ = values["current_user_groups"].([]string)
+
+	token, err := s.handoffCodec().Encode("handoff", h)
+	if err != nil {
+		return "", err
+	}
+
+	next := url.URL{Path: redirectTo.Path, RawQuery: redirectTo.RawQuery}
+	if next.Path == "" {
+		next.Path = "/"
+	}
+
+	u := &url.URL{
+		Scheme: redirectTo.Scheme,
+		Host:   redirectTo.Host,
+		Path:   handoffPath,
+		RawQuery: url.Values{
+			"token":       {token},
+			"redirect_to": {next.String()},
+		}.Encode(),
+	}
+	return u.String(), nil
+}
+
+// authHandoff stores the session handed over from the base domain in a cookie
+// of the custom domain.
+func (s *Server) authHandoff() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var h handoff
+		err := s.handoffCodec().Decode("handoff", r.URL.Query().Get("token"), &h)
+		if err != nil || h.Host != r.Host || h.Nonce == "" || !s.handoffs.use(h.Nonce, handoffTTL, time.Now()) {
+			hlog.FromRequest(r).Warn().Err(err).Msg("rejected session handoff")
+			http.Error(w, "Invalid Handoff", http.StatusBadRequest)
+			return
+		}
+
+		redirectTo := r.URL.Query().Get("redirect_to")
+		if !strings.HasPrefix(redirectTo, "/") || strings.HasPrefix(redirectTo, "//") {
+			redirectTo = "/"
+		}
+
+		session, _ := s.sessionStore.New(r, sessionName)
+		if err := s.renewSession(session); err != nil {
+			log.Error().Err(err).Send()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		options := *session.Options
+		options.Domain = ""
+		session.Options = &options
+		session.Values["current_user_id"] = h.ID
+		session.Values["current_user_email"] = h.Email
+		session.Values["current_user_groups"] = h.Groups
+		if err := session.Save(r, w); err != nil {
+			log.Error().Err(err).Send()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, redirectTo, http.StatusFound)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/mozilla/protodash/sessionstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomDomainLogin(t *testing.T) {
+	s := newTestServer()
+	s.config.OAuthEnabled = true
+	s.config.RedirectToLogin = true
+	s.config.SessionSecret = "secret"
+	d := &Dash{Name: "Report", Slug: "report", Domains: []string{"reports.example.org"}, Config: s.config}
+	domains := customDomains([]*Dash{d})
+
+	// only known hosts are allowed as login redirects
+	assert.True(t, s.allowedRedirectHost("reports.example.org", domains))
+	assert.True(t, s.allowedRedirectHost("report.example.com", domains))
+	assert.False(t, s.allowedRedirectHost("evil.example.org", domains))
+
+	// the session is handed over to the custom domain
+	rtu, _ := url.Parse("https://reports.example.org/weekly/?tab=2")
+	handoffURL, err := s.handoffURL(rtu, map[interface{}]interface{}{
+		"current_user_id":     "user-1",
+		"current_user_email":  "user@example.com",
+		"current_user_groups": []string{"team-a"},
+	})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	s.authHandoff().ServeHTTP(w, httptest.NewRequest("GET", handoffURL, nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/weekly/?tab=2", w.Header().Get("Location"))
+
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Empty(t, cookies[0].Domain)
+
+	u, err := s.currentUser(withCookies(httptest.NewRequest("GET", "https://reports.example.org/weekly/", nil), cookies))
+	assert.NoError(t, err)
+	assert.Equal(t, "user@example.com", u.Email)
+	assert.Equal(t, []string{"team-a"}, u.Groups)
+
+	// handoffs are single-use
+	w = httptest.NewRecorder()
+	s.authHandoff().ServeHTTP(w, httptest.NewRequest("GET", handoffURL, nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// tokens are bound to the custom domain they were issued for
+	handoffURL, _ = s.handoffURL(rtu, map[interface{}]interface{}{"current_user_id": "user-1"})
+	other, _ := url.Parse(handoffURL)
+	other.Host = "other.example.org"
+	w = httptest.NewRecorder()
+	s.authHandoff().ServeHTTP(w, httptest.NewRequest("GET", other.String(), nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCustomDomainRelPath(t *testing.T) {
+	cfg := &Config{BaseDomain: "example.com"}
+	d := &Dash{Slug: "report", Domains: []string{"reports.example.org"}, Config: cfg}
+
+	assert.Equal(t, "weekly/index.html", d.relPath(httptest.NewRequest("GET", "http://reports.example.org/weekly/index.html", nil)))
+	assert.Equal(t, "weekly/index.html", d.relPath(httptest.NewRequest("GET", "http://example.com/report/weekly/index.html", nil)))
+}
+
+func TestLoginRenewsSession(t *testing.T) {
+	s := newTestServer()
+	s.config.OAuthEnabled = true
+	s.config.SessionSecret = "secret"
+	store := sessionstore.New(sessionstore.NewMemoryBackend(), []byte("secret"))
+	store.UserKey = "current_user_id"
+	s.sessionStore = store
+
+	// a session planted before the login
+	planted := loginCookies(t, s, map[interface{}]interface{}{"redirect_to": "/"})
+	r := withCookies(httptest.NewRequest("GET", "https://reports.example.org/", nil), planted)
+	session, _ := store.New(r, sessionName)
+	plantedID := session.ID
+	assert.NotEmpty(t, plantedID)
+
+	rtu, _ := url.Parse("https://reports.example.org/")
+	handoffURL, err := s.handoffURL(rtu, map[interface{}]interface{}{"current_user_id": "user-1"})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	s.authHandoff().ServeHTTP(w, withCookies(httptest.NewRequest("GET", handoffURL, nil), planted))
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	// the login moved to a new session and dropped the planted one
+	session, _ = store.New(withCookies(httptest.NewRequest("GET", "/", nil), w.Result().Cookies()), sessionName)
+	assert.NotEqual(t, plantedID, session.ID)
+	assert.Equal(t, "user-1", session.Values["current_user_id"])
+	assert.Nil(t, session.Values["redirect_to"])
+
+	session, _ = store.New(withCookies(httptest.NewRequest("GET", "/", nil), planted), sessionName)
+	assert.Empty(t, session.ID)
+	assert.Empty(t, session.Values)
+}
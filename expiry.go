@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// lifecycle is the stage of a dashboard with regard to its expiry.
+type lifecycle int
+
+const (
+	active lifecycle = iota
+	// expiring dashboards expire within the expiry warning period
+	expiring
+	// expired dashboards are still served, behind a notice, during the grace
+	// period
+	expired
+	// gone dashboards are archived or past their grace period
+	gone
+)
+
+// expiresAt returns when the dashboard expires, at the end of its expires_on
+// day.
+func (d *Dash) expiresAt() time.Time {
+	y, m, day := d.ExpiresOn.Date()
+	return time.Date(y, m, day+1, 0, 0, 0, 0, time.UTC)
+}
+
+func (d *Dash) lifecycle(now time.Time) lifecycle {
+	switch {
+	case d.Archived:
+		return gone
+	case d.ExpiresOn.IsZero():
+		return active
+	case now.After(d.expiresAt().Add(d.Config.ExpiryGracePeriod)):
+		return gone
+	case now.After(d.expiresAt()):
+		return expired
+	case now.After(d.expiresAt().Add(-d.Config.ExpiryWarning)):
+		return expiring
+	}
+	return active
+}
+
+// ExpiryNotice returns the notice shown next to the dashboard on the index
+// page when it expires soon or has expired.
+func (d *Dash) ExpiryNotice() string {
+	switch d.lifecycle(time.Now()) {
+	case expiring:
+		return "expires on " + d.ExpiresOn.Format("2006-01-02")
+	case expired:
+		return "expired on " + d.ExpiresOn.Format("2006-01-02")
+	}
+	return ""
+}
+
+func expiryCookieName(d *Dash) string {
+	return "_protodash_expired_" + d.Slug
+}
+
+// checkExpiry answers with 410 Gone for archived dashboards and those past
+// their grace period. Expired dashboards show a notice before the first page
+// is served, until the user chooses to continue.
+func (s *Server) checkExpiry(d *Dash) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state := d.lifecycle(time.Now())
+			if state == gone {
+				hlog.FromRequest(r).Info().Str("dashboard", d.Name).Msg("dashboard is gone")
+				s.renderPage(w, http.StatusGone, "expiry.gohtml", &expiryPageData{Dash: d, Gone: true})
+				return
+			}
+			if state != expired {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.URL.Query().Get("continue_expired") != "" {
+				http.SetCookie(w, &http.Cookie{
+					Name:     expiryCookieName(d),
+					Value:    "1",
+					Path:     "/",
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+				q := r.URL.Query()
+				q.Del("continue_expired")
+				u := *r.URL
+				u.RawQuery = q.Encode()
+				http.Redirect(w, r, u.RequestURI(), http.StatusSeeOther)
+				return
+			}
+
+			// only pages get the notice, not the assets they load
+			if _, err := r.Cookie(expiryCookieName(d)); err == nil ||
+				r.Method != http.MethodGet ||
+				!strings.Contains(r.Header.Get("Accept"), "text/html") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			q := r.URL.Query()
+			q.Set("continue_expired", "1")
+			u := *r.URL
+			u.RawQuery = q.Encode()
+
+			w.Header().Set("Cache-Control", "no-store")
+			s.renderPage(w, http.StatusOK, "expiry.gohtml", &expiryPageData{Dash: d, ContinueURL: u.RequestURI()})
+		})
+	}
+}
+
+type expiryPageData struct {
+	*Dash
+	Gone        bool
+	ContinueURL string
+}
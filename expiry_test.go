@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycle(t *testing.T) {
+	cfg := &Config{ExpiryWarning: 30 * 24 * time.Hour, ExpiryGracePeriod: 14 * 24 * time.Hour}
+	d := &Dash{Config: cfg, ExpiresOn: time.Date(2021, 6, 30, 0, 0, 0, 0, time.UTC)}
+
+	assert.Equal(t, active, d.lifecycle(time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, expiring, d.lifecycle(time.Date(2021, 6, 15, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, expiring, d.lifecycle(time.Date(2021, 6, 30, 23, 0, 0, 0, time.UTC)))
+	assert.Equal(t, expired, d.lifecycle(time.Date(2021, 7, 1, 1, 0, 0, 0, time.UTC)))
+	assert.Equal(t, gone, d.lifecycle(time.Date(2021, 7, 16, 0, 0, 0, 0, time.UTC)))
+
+	assert.Equal(t, active, (&Dash{Config: cfg}).lifecycle(time.Now()))
+	assert.Equal(t, gone, (&Dash{Config: cfg, Archived: true}).lifecycle(time.Now()))
+}
+
+func TestCheckExpiry(t *testing.T) {
+	s := newTestServer()
+	s.config.ExpiryGracePeriod = 14 * 24 * time.Hour
+	d := &Dash{
+		Name:      "Report",
+		Slug:      "report",
+		Owner:     "Jane Doe",
+		Contact:   "jane@example.com",
+		Config:    s.config,
+		ExpiresOn: time.Now().AddDate(0, 0, -2),
+	}
+	h := s.checkExpiry(d)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("dashboard"))
+	}))
+
+	// pages get the notice
+	r := httptest.NewRequest("GET", "/report/?tab=1", nil)
+	r.Header.Set("Accept", "text/html,*/*")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "This dashboard expired on")
+	assert.Contains(t, w.Body.String(), `href="/report/?continue_expired=1&amp;tab=1"`)
+
+	// assets don't
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/report/app.js", nil))
+	assert.Equal(t, "dashboard", w.Body.String())
+
+	// continuing sets a cookie and redirects back
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/report/?continue_expired=1&tab=1", nil))
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/report/?tab=1", w.Header().Get("Location"))
+
+	r = withCookies(httptest.NewRequest("GET", "/report/?tab=1", nil), w.Result().Cookies())
+	r.Header.Set("Accept", "text/html,*/*")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, "dashboard", w.Body.String())
+
+	// archived dashboards are gone
+	d.Archived = true
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/report/", nil))
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Contains(t, w.Body.String(), "This dashboard has been archived.")
+	assert.Contains(t, w.Body.String(), `Contact Jane Doe at <a href="mailto:jane@example.com">jane@example.com</a>`)
+}
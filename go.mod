@@ -1,18 +1,23 @@
 module github.com/mozilla/protodash
 
-go 1.14
+go 1.16
 
 require (
 	cloud.google.com/go/storage v1.12.0
+	github.com/alicebob/miniredis/v2 v2.14.1
 	github.com/gobuffalo/flect v0.2.2
+	github.com/gomodule/redigo v1.8.3
 	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/securecookie v1.1.1
 	github.com/gorilla/sessions v1.2.1
-	github.com/jarcoal/httpmock v1.0.6
+	github.com/jarcoal/httpmock v1.0.6 // indirect
 	github.com/justinas/alice v1.2.0
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/markbates/goth v1.66.1
 	github.com/rs/zerolog v1.20.0
 	github.com/stretchr/testify v1.6.1
+	go.etcd.io/bbolt v1.3.5
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 	golang.org/x/oauth2 v0.0.0-20210113205817-d3ed898aa8a3
 	google.golang.org/api v0.36.0
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/rs/zerolog/hlog"
+	"github.com/rs/zerolog/log"
+)
+
+// impersonatedUser returns the user the admin is viewing the site as, or the
+// admin if they aren't impersonating anyone or the impersonation expired.
+func (s *Server) impersonatedUser(session *sessions.Session, admin *User) *User {
+	email, ok := session.Values["impersonate_email"].(string)
+	if !ok || !s.isAdmin(admin) {
+		return admin
+	}
+
+	until, _ := session.Values["impersonate_until"].(int64)
+	if time.Now().Unix() > until {
+		return admin
+	}
+
+	groups, _ := session.Values["impersonate_groups"].([]string)
+	return &User{
+		ID:                email,
+		Email:             email,
+		Groups:            groups,
+		Method:            admin.Method,
+		Impersonator:      admin,
+		ImpersonationEnds: time.Unix(until, 0),
+	}
+}
+
+const (
+	// impersonationParam is the query parameter of impersonation links.
+	impersonationParam = "impersonation"
+	// impersonationLinkTTL bounds how long an impersonation link can be
+	// opened after it was created.
+	impersonationLinkTTL = 5 * time.Minute
+)
+
+// impersonationLink is the impersonation an admin starts by opening the link
+// in their browser.
+type impersonationLink struct {
+	Admin  string
+	Email  string
+	Groups []string
+	// Nonce makes the link single-use
+	Nonce string
+}
+
+// impersonationCodec signs and encrypts impersonation links, with keys
+// derived from the session secret.
+func (s *Server) impersonationCodec() *securecookie.SecureCookie {
+	hashKey := sha256.Sum256([]byte("protodash impersonation\x00" + s.config.SessionSecret))
+	blockKey := sha256.Sum256([]byte("protodash impersonation encryption\x00" + s.config.SessionSecret))
+	codec := securecookie.New(hashKey[:], blockKey[:])
+	codec.MaxAge(int(impersonationLinkTTL / time.Second))
+	return codec
+}
+
+type impersonationResponse struct {
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// adminImpersonate creates a link for viewing the site as the user and groups
+// given in the request. Impersonation lives in the browser session of the
+// admin, but the browser can't be trusted with starting it since dashboard
+// pages share its origin, so the link is created with a bearer token and then
+// opened by the admin. With the admin token, the admin is given in the
+// request.
+func (s *Server) adminImpersonate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin := userFromContext(r.Context())
+		if admin == nil {
+			admin = &User{Email: r.FormValue("admin")}
+			if !s.isAdmin(admin) {
+				http.Error(w, "Unknown Admin", http.StatusBadRequest)
+				return
+			}
+		}
+
+		email := strings.TrimSpace(r.FormValue("email"))
+		if email == "" {
+			http.Error(w, "Missing Email", http.StatusBadRequest)
+			return
+		}
+
+		var groups []string
+		for _, g := range strings.Split(r.FormValue("groups"), ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				groups = append(groups, g)
+			}
+		}
+
+		token, err := s.impersonationCodec().Encode("impersonation", &impersonationLink{
+			Admin:  admin.Email,
+			Email:  email,
+			Groups: groups,
+			Nonce:  base64.RawURLEncoding.EncodeToString(securecookie.GenerateRandomKey(16)),
+		})
+		if err != nil {
+			log.Error().Err(err).Send()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		u := &url.URL{
+			Scheme:   requestScheme(r),
+			Host:     s.config.BaseDomain,
+			Path:     "/admin/impersonate",
+			RawQuery: url.Values{impersonationParam: {token}}.Encode(),
+		}
+
+		hlog.FromRequest(r).Info().
+			Str("admin", admin.Email).
+			Str("impersonated", email).
+			Strs("groups", groups).
+			Msg("created impersonation link")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&impersonationResponse{
+			URL:     u.String(),
+			Expires: time.Now().Add(impersonationLinkTTL).UTC(),
+		})
+	}
+}
+
+// adminStartImpersonating starts viewing the site as the user of the
+// impersonation link, for ImpersonationTTL. The link can only be used once,
+// by the admin it was created for.
+func (s *Server) adminStartImpersonating() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin := userFromContext(r.Context())
+		if admin == nil || admin.Method != "session" || !s.isAdmin(admin.real()) {
+			http.Error(w, "Impersonation Requires An Admin Browser Session", http.StatusForbidden)
+			return
+		}
+		admin = admin.real()
+
+		var link impersonationLink
+		err := s.impersonationCodec().Decode("impersonation", r.URL.Query().Get(impersonationParam), &link)
+		if err != nil || !strings.EqualFold(link.Admin, admin.Email) || link.Nonce == "" ||
+			!s.impersonations.use(link.Nonce, impersonationLinkTTL, time.Now()) {
+			hlog.FromRequest(r).Warn().Err(err).Msg("rejected impersonation link")
+			http.Error(w, "Invalid Impersonation Link", http.StatusBadRequest)
+			return
+		}
+
+		until := time.Now().Add(s.config.ImpersonationTTL)
+
+		session, _ := s.sessionStore.Get(r, sessionName)
+		session.Values["impersonate_email"] = link.Email
+		session.Values["impersonate_groups"] = link.Groups
+		session.Values["impersonate_until"] = until.Unix()
+		if err := session.Save(r, w); err != nil {
+			log.Error().Err(err).Send()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		hlog.FromRequest(r).Info().
+			Str("impersonated", link.Email).
+			Strs("groups", link.Groups).
+			Time("until", until).
+			Msg("started impersonation")
+
+		http.Redirect(w, r, "//"+s.config.BaseDomain+"/", http.StatusSeeOther)
+	}
+}
+
+// adminStopImpersonating goes back to viewing the site as the admin. It only
+// ever takes rights away, so it is left to browser sessions from pages of the
+// base domain.
+func (s *Server) adminStopImpersonating() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.checkOrigin(r); err != nil {
+			hlog.FromRequest(r).Warn().Err(err).Msg("rejected stopping impersonation")
+			http.Error(w, "403 Forbidden", http.StatusForbidden)
+			return
+		}
+
+		session, _ := s.sessionStore.Get(r, sessionName)
+		delete(session.Values, "impersonate_email")
+		delete(session.Values, "impersonate_groups")
+		delete(session.Values, "impersonate_until")
+		if err := session.Save(r, w); err != nil {
+			log.Error().Err(err).Send()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		hlog.FromRequest(r).Info().Msg("stopped impersonation")
+
+		http.Redirect(w, r, "//"+s.config.BaseDomain+"/", http.StatusSeeOther)
+	}
+}
+
+// addImpersonationBanner marks a dashboard response served to an impersonated
+// user, injecting a banner into HTML pages so it is obvious whose view it is.
+func addImpersonationBanner(r *http.Request, resp *http.Response, u *User, tmpl *template.Template) error {
+	resp.Header.Set("X-Protodash-Impersonating", u.Email)
+	resp.Header.Set("Cache-Control", "no-store")
+	resp.Header.Del("ETag")
+
+	if r.Method != http.MethodGet ||
+		resp.StatusCode != http.StatusOK ||
+		resp.Header.Get("Content-Encoding") != "" ||
+		!strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return nil
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	i := bytes.LastIndex(bytes.ToLower(data), []byte("</body>"))
+	if i < 0 {
+		i = len(data)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data[:i])
+	if err = tmpl.ExecuteTemplate(&buf, "banner.gohtml", u); err != nil {
+		return err
+	}
+	buf.Write(data[i:])
+
+	resp.Body = ioutil.NopCloser(&buf)
+	resp.Header.Set("Content-Length", strconv.Itoa(buf.Len()))
+	return nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loginCookies(t *testing.T, s *Server, values map[interface{}]interface{}) []*http.Cookie {
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	session, _ := s.sessionStore.New(r, sessionName)
+	for k, v := range values {
+		session.Values[k] = v
+	}
+	assert.NoError(t, session.Save(r, w))
+	return w.Result().Cookies()
+}
+
+func withCookies(r *http.Request, cookies []*http.Cookie) *http.Request {
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+func TestImpersonation(t *testing.T) {
+	s := newTestServer()
+	s.config.OAuthEnabled = true
+	s.config.Admins = []string{"admin@example.com", "other-admin@example.com"}
+	s.config.AdminToken = "admin-token"
+	s.config.ImpersonationTTL = time.Hour
+	s.config.SessionSecret = "session-secret"
+
+	admin := loginCookies(t, s, map[interface{}]interface{}{
+		"current_user_id":    "admin-1",
+		"current_user_email": "admin@example.com",
+	})
+
+	// create an impersonation link
+	body := strings.NewReader("admin=admin@example.com&email=user@example.com&groups=team-a,+team-b")
+	r := httptest.NewRequest("POST", "/admin/impersonate", body)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Authorization", "Bearer admin-token")
+	w := httptest.NewRecorder()
+	s.requireAdmin(s.adminImpersonate()).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp impersonationResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.True(t, strings.HasPrefix(resp.URL, "http://example.com/admin/impersonate?impersonation="))
+
+	// the link only works for the admin it was created for
+	other := loginCookies(t, s, map[interface{}]interface{}{
+		"current_user_id":    "admin-2",
+		"current_user_email": "other-admin@example.com",
+	})
+	start := s.requireAuth(s.adminStartImpersonating())
+	w = httptest.NewRecorder()
+	start.ServeHTTP(w, withCookies(httptest.NewRequest("GET", resp.URL, nil), other))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// opening the link starts impersonating
+	w = httptest.NewRecorder()
+	start.ServeHTTP(w, withCookies(httptest.NewRequest("GET", resp.URL, nil), admin))
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	impersonating := w.Result().Cookies()
+
+	u, err := s.currentUser(withCookies(httptest.NewRequest("GET", "/", nil), impersonating))
+	assert.NoError(t, err)
+	assert.Equal(t, "user@example.com", u.Email)
+	assert.Equal(t, []string{"team-a", "team-b"}, u.Groups)
+	assert.Equal(t, "admin@example.com", u.Impersonator.Email)
+
+	// links are single-use
+	w = httptest.NewRecorder()
+	start.ServeHTTP(w, withCookies(httptest.NewRequest("GET", resp.URL, nil), admin))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// stopping only needs to come from the base domain
+	r = withCookies(httptest.NewRequest("POST", "/admin/impersonate/stop", nil), impersonating)
+	w = httptest.NewRecorder()
+	s.adminStopImpersonating().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	r.Header.Set("Origin", "https://example.com")
+	w = httptest.NewRecorder()
+	s.adminStopImpersonating().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+
+	u, _ = s.currentUser(withCookies(httptest.NewRequest("GET", "/", nil), w.Result().Cookies()))
+	assert.Equal(t, "admin@example.com", u.Email)
+	assert.Nil(t, u.Impersonator)
+}
+
+func TestImpersonationRequiresAdmin(t *testing.T) {
+	s := newTestServer()
+	s.config.OAuthEnabled = true
+	s.config.Admins = []string{"admin@example.com"}
+
+	user := loginCookies(t, s, map[interface{}]interface{}{
+		"current_user_id":    "user-1",
+		"current_user_email": "user@example.com",
+	})
+
+	r := withCookies(httptest.NewRequest("POST", "/admin/impersonate?email=other@example.com", nil), user)
+	w := httptest.NewRecorder()
+	s.requireAdmin(s.adminImpersonate()).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// links can't be opened by other users
+	w = httptest.NewRecorder()
+	s.requireAuth(s.adminStartImpersonating()).ServeHTTP(w, withCookies(httptest.NewRequest("GET", "/admin/impersonate", nil), user))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// impersonation values in the session of a non admin are ignored
+	cookies := loginCookies(t, s, map[interface{}]interface{}{
+		"current_user_id":    "user-1",
+		"current_user_email": "user@example.com",
+		"impersonate_email":  "other@example.com",
+		"impersonate_until":  time.Now().Add(time.Hour).Unix(),
+	})
+	u, _ := s.currentUser(withCookies(httptest.NewRequest("GET", "/", nil), cookies))
+	assert.Equal(t, "user@example.com", u.Email)
+}
+
+func TestImpersonationExpires(t *testing.T) {
+	s := newTestServer()
+	s.config.OAuthEnabled = true
+	s.config.Admins = []string{"admin@example.com"}
+
+	cookies := loginCookies(t, s, map[interface{}]interface{}{
+		"current_user_id":    "admin-1",
+		"current_user_email": "admin@example.com",
+		"impersonate_email":  "other@example.com",
+		"impersonate_until":  time.Now().Add(-time.Minute).Unix(),
+	})
+	u, _ := s.currentUser(withCookies(httptest.NewRequest("GET", "/", nil), cookies))
+	assert.Equal(t, "admin@example.com", u.Email)
+}
+
+func TestAuthorizeGroups(t *testing.T) {
+	s := newTestServer()
+	s.config.OAuthEnabled = true
+	s.config.Admins = []string{"admin@example.com"}
+	d := &Dash{Slug: "report", Groups: []string{"team-a"}}
+
+	tests := []struct {
+		user   *User
+		status int
+	}{
+		{&User{ID: "1", Groups: []string{"team-a"}, Method: "session"}, http.StatusOK},
+		{&User{ID: "2", Groups: []string{"team-b"}, Method: "session"}, http.StatusForbidden},
+		{&User{ID: "3", Email: "admin@example.com", Method: "session"}, http.StatusOK},
+		{&User{ID: "4", Method: "share"}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/report/", nil)
+		r = r.WithContext(withUser(r.Context(), tt.user))
+		w := httptest.NewRecorder()
+		s.authorize(d)(echoUser()).ServeHTTP(w, r)
+		assert.Equal(t, tt.status, w.Code, tt.user.ID)
+	}
+}
+
+func TestImpersonationBanner(t *testing.T) {
+	u := &User{
+		Email:             "user@example.com",
+		Impersonator:      &User{Email: "admin@example.com"},
+		ImpersonationEnds: time.Now(),
+	}
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/html"}, "Etag": {"abc"}},
+		Body:       ioutil.NopCloser(strings.NewReader("<html><body><p>hi</p></body></html>")),
+	}
+
+	tmpl := newTestServer().tmpl
+	assert.NoError(t, addImpersonationBanner(httptest.NewRequest("GET", "/", nil), resp, u, tmpl))
+	data, _ := ioutil.ReadAll(resp.Body)
+	assert.Contains(t, string(data), "Viewing as user@example.com (impersonated by admin@example.com")
+	assert.True(t, strings.HasSuffix(string(data), "</div>\n</body></html>"))
+	assert.Equal(t, "user@example.com", resp.Header.Get("X-Protodash-Impersonating"))
+	assert.Empty(t, resp.Header.Get("ETag"))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexMetadata(t *testing.T) {
+	s := newTestServer()
+	dashboards := []*Dash{{
+		Name:        "Weekly Report",
+		Slug:        "report",
+		Public:      true,
+		Description: "Weekly numbers",
+		Owner:       "Jane Doe",
+		Contact:     "jane@example.com",
+		Team:        "data-eng",
+		Tags:        []string{"weekly"},
+	}}
+
+	w := httptest.NewRecorder()
+	s.index(dashboards).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	body := w.Body.String()
+
+	assert.Contains(t, body, `<a href="/report/">Weekly Report</a>`)
+	assert.Contains(t, body, "Weekly numbers")
+	assert.Contains(t, body, "Owner: Jane Doe")
+	assert.Contains(t, body, `<a href="mailto:jane@example.com">Contact</a>`)
+	assert.Contains(t, body, "#weekly")
+}
+
+func TestIndexSearch(t *testing.T) {
+	s := newTestServer()
+	dashboards := []*Dash{
+		{Name: "Crash Rates", Slug: "crashes", Public: true, Team: "stability"},
+		{Name: "Revenue", Slug: "revenue", Public: true, Team: "finance"},
+	}
+
+	w := httptest.NewRecorder()
+	s.index(dashboards).ServeHTTP(w, httptest.NewRequest("GET", "/?q=crash&group_by=team", nil))
+	body := w.Body.String()
+
+	assert.Contains(t, body, "1 matching dashboards")
+	assert.Contains(t, body, "<h2>stability</h2>")
+	assert.Contains(t, body, `<a href="/crashes/">Crash Rates</a>`)
+	assert.NotContains(t, body, `<a href="/revenue/">Revenue</a>`)
+	assert.Contains(t, body, `<option value="team" selected>`)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const secretScheme = "secret://"
+
+// envName matches the names of the variables of ${VAR} references.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// references resolves the ${VAR} references to environment variables and
+// secret://name references to files of the secrets directory found in config
+// values, so that secrets don't need to be committed.
+type references struct {
+	lookupEnv  func(string) (string, bool)
+	secretsDir string
+	// check only checks the syntax of the references, without resolving them
+	check bool
+}
+
+func newReferences(config *Config) *references {
+	return &references{lookupEnv: os.LookupEnv, secretsDir: config.SecretsDir}
+}
+
+// interpolate resolves the references in every string value of the dashboard
+// config.
+func (refs *references) interpolate(d *Dash) []error {
+	return refs.interpolateValue(reflect.ValueOf(d).Elem(), "")
+}
+
+func (refs *references) interpolateValue(v reflect.Value, field string) []error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return refs.interpolateValue(v.Elem(), field)
+		}
+	case reflect.String:
+		resolved, err := refs.resolve(v.String())
+		if err != nil {
+			return []error{fmt.Errorf("%s: %w", field, err)}
+		}
+		v.SetString(resolved)
+	case reflect.Slice:
+		var errs []error
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, refs.interpolateValue(v.Index(i), fmt.Sprintf("%s[%d]", field, i))...)
+		}
+		return errs
+	case reflect.Struct:
+		var errs []error
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			name, ok := yamlFieldName(f)
+			if !ok {
+				continue
+			}
+			if field != "" {
+				name = field + "." + name
+			}
+			errs = append(errs, refs.interpolateValue(v.Field(i), name)...)
+		}
+		return errs
+	}
+	return nil
+}
+
+// hasReference returns whether the value holds a reference, a ${ escaped as
+// $${ isn't one.
+func hasReference(value string) bool {
+	if strings.HasPrefix(value, secretScheme) {
+		return true
+	}
+	for i := 0; i+1 < len(value); i++ {
+		if value[i] != '$' {
+			continue
+		}
+		switch value[i+1] {
+		case '{':
+			return true
+		case '$':
+			i++
+		}
+	}
+	return false
+}
+
+// resolve returns the value with its references resolved. A secret:// reference
+// is the whole value, ${VAR} references can be mixed with text and $$ is a
+// literal $. When only checking, the value is returned as is.
+func (refs *references) resolve(value string) (string, error) {
+	if strings.HasPrefix(value, secretScheme) {
+		secret, err := refs.readSecret(strings.TrimPrefix(value, secretScheme))
+		if refs.check && err == nil {
+			return value, nil
+		}
+		return secret, err
+	}
+
+	if !strings.Contains(value, "$") {
+		return value, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+
+		switch value[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(value[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", value)
+			}
+			name := value[i+2 : i+2+end]
+			if !envName.MatchString(name) {
+				return "", fmt.Errorf("invalid variable name %q", name)
+			}
+			if !refs.check {
+				resolved, ok := refs.lookupEnv(name)
+				if !ok {
+					return "", fmt.Errorf("variable %s is not set", name)
+				}
+				b.WriteString(resolved)
+			}
+			i += 2 + end
+		default:
+			b.WriteByte('$')
+		}
+	}
+
+	if refs.check {
+		return value, nil
+	}
+	return b.String(), nil
+}
+
+func (refs *references) readSecret(name string) (string, error) {
+	if name == "" || path.IsAbs(name) || path.Clean(name) != name || strings.HasPrefix(name, "../") || name == ".." {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	if refs.check {
+		return "", nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(refs.secretsDir, filepath.FromSlash(name)))
+	if err != nil {
+		return "", fmt.Errorf("reading secret %s: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveReferences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "partner-password"), []byte("s3cret\n"), 0600))
+
+	env := map[string]string{"BUCKET": "reports", "TEAM": "data"}
+	refs := &references{
+		lookupEnv: func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		},
+		secretsDir: dir,
+	}
+
+	tests := []struct {
+		value    string
+		resolved string
+		err      string
+	}{
+		{"plain", "plain", ""},
+		{"${BUCKET}", "reports", ""},
+		{"moz-${TEAM}-${BUCKET}", "moz-data-reports", ""},
+		{"costs $5, $${BUCKET}", "costs $5, ${BUCKET}", ""},
+		{"secret://partner-password", "s3cret", ""},
+		{"${MISSING}", "", "variable MISSING is not set"},
+		{"${BUCKET", "", `unterminated ${ in "${BUCKET"`},
+		{"${1X}", "", `invalid variable name "1X"`},
+		{"secret://../etc/passwd", "", `invalid secret name "../etc/passwd"`},
+	}
+
+	for _, tt := range tests {
+		resolved, err := refs.resolve(tt.value)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err, tt.value)
+			continue
+		}
+		assert.NoError(t, err, tt.value)
+		assert.Equal(t, tt.resolved, resolved, tt.value)
+	}
+}
+
+func TestInterpolateDashboards(t *testing.T) {
+	files := []configFile{{name: "config.yml", data: []byte(`
+report:
+  gcs_bucket: reports
+  basic_auth:
+    password: ${PROTODASH_TEST_MISSING}
+    users: ["secret://report-users"]
+`)}}
+	dir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "report-users"), []byte("alice:$2y$10$hash\n"), 0600))
+
+	_, err := decodeDashboards(files, &Config{}, newReferences(&Config{SecretsDir: dir}))
+	assert.EqualError(t, err, "config.yml: dashboard report: basic_auth.password: variable PROTODASH_TEST_MISSING is not set")
+
+	// validation only checks the references
+	dashboards, err := decodeDashboards(files, &Config{}, &references{check: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "${PROTODASH_TEST_MISSING}", dashboards[0].BasicAuth.Password)
+
+	os.Setenv("PROTODASH_TEST_MISSING", "shared")
+	defer os.Unsetenv("PROTODASH_TEST_MISSING")
+	dashboards, err = decodeDashboards(files, &Config{}, newReferences(&Config{SecretsDir: dir}))
+	assert.NoError(t, err)
+	assert.Equal(t, "shared", dashboards[0].BasicAuth.Password)
+	assert.Equal(t, []string{"alice:$2y$10$hash"}, dashboards[0].BasicAuth.Users)
+}
+
+func TestInterpolateEveryField(t *testing.T) {
+	os.Setenv("PROTODASH_TEST_BUCKET", "reports-prod")
+	defer os.Unsetenv("PROTODASH_TEST_BUCKET")
+
+	files := []configFile{{name: "config.yml", data: []byte(`
+report:
+  gcs_bucket: ${PROTODASH_TEST_BUCKET}
+  tags: ["team-${PROTODASH_TEST_BUCKET}"]
+  description: costs $5, written as $${NAME}
+`)}}
+
+	dashboards, err := decodeDashboards(files, &Config{}, newReferences(&Config{}))
+	assert.NoError(t, err)
+	assert.Equal(t, "reports-prod", dashboards[0].Bucket)
+	assert.Equal(t, []string{"team-reports-prod"}, dashboards[0].Tags)
+	assert.Equal(t, "costs $5, written as ${NAME}", dashboards[0].Description)
+}
+
+func TestHasReference(t *testing.T) {
+	assert.True(t, hasReference("${VAR}"))
+	assert.True(t, hasReference("secret://name"))
+	assert.True(t, hasReference("$$${VAR}"))
+	assert.False(t, hasReference("$${VAR}"))
+	assert.False(t, hasReference("alice:$2y$05$hash"))
+}
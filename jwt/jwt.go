@@ -0,0 +1,233 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed        = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrExpired          = errors.New("token is expired")
+	ErrMissingExpiry    = errors.New("token has no expiry")
+	ErrNotYetValid      = errors.New("token is not valid yet")
+	ErrInvalidIssuer    = errors.New("invalid token issuer")
+	ErrInvalidAudience  = errors.New("invalid token audience")
+)
+
+// Header is the decoded JOSE header of a token.
+type Header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// Claims are the decoded claims of a token.
+type Claims map[string]interface{}
+
+// String returns the named claim if it is a string.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns the named claim as a list of strings, a single string claim
+// is returned as a list with one element.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var ss []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+		return ss
+	}
+	return nil
+}
+
+// Time returns the named numeric date claim, or the zero time if not set.
+func (c Claims) Time(name string) time.Time {
+	if f, ok := c[name].(float64); ok {
+		return time.Unix(int64(f), 0)
+	}
+	return time.Time{}
+}
+
+// Subject returns the sub claim.
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// Verifier checks the signature and registered claims of tokens.
+type Verifier struct {
+	Keys KeySet
+	// Issuer, if set, must match the iss claim.
+	Issuer string
+	// Audience, if set, must be one of the aud claim values.
+	Audience string
+	// Leeway is the allowed clock skew when checking exp and nbf.
+	Leeway time.Duration
+
+	now func() time.Time
+}
+
+// NewVerifier returns a Verifier using keys to check signatures.
+func NewVerifier(keys KeySet, issuer, audience string) *Verifier {
+	return &Verifier{
+		Keys:     keys,
+		Issuer:   issuer,
+		Audience: audience,
+		Leeway:   time.Minute,
+		now:      time.Now,
+	}
+}
+
+// Verify parses token, checks its signature and registered claims and returns
+// its claims.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	header, claims, signingInput, sig, err := parse(token)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := v.Keys.Key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = verifySignature(header.Alg, key, signingInput, sig); err != nil {
+		return nil, err
+	}
+
+	// tokens without an expiry would be valid forever
+	now := v.now()
+	exp := claims.Time("exp")
+	if exp.IsZero() {
+		return nil, ErrMissingExpiry
+	}
+	if now.After(exp.Add(v.Leeway)) {
+		return nil, ErrExpired
+	}
+	if nbf := claims.Time("nbf"); !nbf.IsZero() && now.Add(v.Leeway).Before(nbf) {
+		return nil, ErrNotYetValid
+	}
+	if v.Issuer != "" && claims.String("iss") != v.Issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if v.Audience != "" && !contains(claims.Strings("aud"), v.Audience) {
+		return nil, ErrInvalidAudience
+	}
+
+	return claims, nil
+}
+
+// ParseUnverified decodes the claims of token without checking its signature.
+// It must only be used on tokens received directly from a trusted party.
+func ParseUnverified(token string) (Claims, error) {
+	_, claims, _, _, err := parse(token)
+	return claims, err
+}
+
+func parse(token string) (*Header, Claims, string, []byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, "", nil, ErrMalformed
+	}
+
+	header := &Header{}
+	if err := decodeSegment(parts[0], header); err != nil {
+		return nil, nil, "", nil, err
+	}
+
+	claims := Claims{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, nil, "", nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, "", nil, ErrMalformed
+	}
+
+	return header, claims, parts[0] + "." + parts[1], sig, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrMalformed
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return ErrMalformed
+	}
+	return nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signingInput string, sig []byte) error {
+	var h hash.Hash
+	var ch crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		h, ch = sha256.New(), crypto.SHA256
+	case "RS384", "ES384":
+		h, ch = sha512.New384(), crypto.SHA384
+	case "RS512", "ES512":
+		h, ch = sha512.New(), crypto.SHA512
+	default:
+		return ErrUnsupportedAlg
+	}
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' {
+			return ErrUnsupportedAlg
+		}
+		if err := rsa.VerifyPKCS1v15(k, ch, digest, sig); err != nil {
+			return ErrInvalidSignature
+		}
+	case *ecdsa.PublicKey:
+		if alg[0] != 'E' {
+			return ErrUnsupportedAlg
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+
+	return nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
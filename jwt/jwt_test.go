@@ -0,0 +1,133 @@
+package jwt_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mozilla/protodash/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com/"
+	testAudience = "protodash"
+)
+
+func sign(t *testing.T, key crypto.Signer, alg, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(input))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		assert.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		assert.NoError(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   testIssuer,
+		"aud":   []string{testAudience, "other"},
+		"sub":   "user-1",
+		"email": "user@example.com",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestVerifyRS256(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	v := jwt.NewVerifier(jwt.StaticKeySet{"k1": &key.PublicKey}, testIssuer, testAudience)
+
+	claims, err := v.Verify(sign(t, key, "RS256", "k1", validClaims()))
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject())
+	assert.Equal(t, "user@example.com", claims.String("email"))
+}
+
+func TestVerifyES256(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	v := jwt.NewVerifier(jwt.StaticKeySet{"k1": &key.PublicKey}, testIssuer, testAudience)
+
+	_, err := v.Verify(sign(t, key, "ES256", "k1", validClaims()))
+	assert.NoError(t, err)
+}
+
+func TestVerifyRejects(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	v := jwt.NewVerifier(jwt.StaticKeySet{"k1": &key.PublicKey}, testIssuer, testAudience)
+
+	with := func(name string, value interface{}) map[string]interface{} {
+		c := validClaims()
+		c[name] = value
+		return c
+	}
+
+	tests := []struct {
+		token string
+		err   error
+	}{
+		{"not-a-token", jwt.ErrMalformed},
+		{sign(t, otherKey, "RS256", "k1", validClaims()), jwt.ErrInvalidSignature},
+		{sign(t, key, "RS256", "k2", validClaims()), jwt.ErrUnknownKey},
+		{sign(t, key, "RS256", "k1", with("exp", time.Now().Add(-time.Hour).Unix())), jwt.ErrExpired},
+		{sign(t, key, "RS256", "k1", with("exp", nil)), jwt.ErrMissingExpiry},
+		{sign(t, key, "RS256", "k1", with("nbf", time.Now().Add(time.Hour).Unix())), jwt.ErrNotYetValid},
+		{sign(t, key, "RS256", "k1", with("iss", "https://evil.example.com/")), jwt.ErrInvalidIssuer},
+		{sign(t, key, "RS256", "k1", with("aud", "other")), jwt.ErrInvalidAudience},
+	}
+
+	for _, tt := range tests {
+		_, err := v.Verify(tt.token)
+		assert.Equal(t, tt.err, err)
+	}
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	fetches := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":"k1","n":"%s","e":"AQAB"}]}`,
+			base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()))
+	}))
+	defer ts.Close()
+
+	ks := jwt.NewRemoteKeySet(ts.URL, nil)
+	v := jwt.NewVerifier(ks, testIssuer, testAudience)
+
+	_, err := v.Verify(sign(t, key, "RS256", "k1", validClaims()))
+	assert.NoError(t, err)
+	_, err = v.Verify(sign(t, key, "RS256", "k1", validClaims()))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fetches)
+
+	// unknown keys don't refetch more than once per MinRefresh
+	_, err = v.Verify(sign(t, key, "RS256", "k2", validClaims()))
+	assert.Equal(t, jwt.ErrUnknownKey, err)
+	assert.Equal(t, 1, fetches)
+}
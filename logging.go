@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"time"
 
@@ -33,7 +34,7 @@ func newLoggingChain() alice.Chain {
 		hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
 			hlog.FromRequest(r).Info().
 				Str("method", r.Method).
-				Str("url", r.URL.String()).
+				Str("url", redactURL(r.URL)).
 				Int("status", status).
 				Int("size", size).
 				Dur("duration", duration).
@@ -41,8 +42,46 @@ func newLoggingChain() alice.Chain {
 		}),
 		hlog.RemoteAddrHandler("ip"),
 		hlog.UserAgentHandler("user_agent"),
-		hlog.RefererHandler("referer"),
+		refererHandler("referer"),
 	)
 
 	return chain
 }
+
+// redactedParams are the query parameters carrying credentials, which are
+// kept out of the logs.
+var redactedParams = []string{"token", shareParam, impersonationParam}
+
+// redactURL returns the URL with the values of credential parameters
+// replaced.
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	redacted := false
+	for _, name := range redactedParams {
+		if _, ok := q[name]; ok {
+			q.Set(name, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.String()
+	}
+
+	clean := *u
+	clean.RawQuery = q.Encode()
+	return clean.String()
+}
+
+// refererHandler is hlog.RefererHandler with the credentials redacted.
+func refererHandler(fieldKey string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if u, err := url.Parse(r.Header.Get("Referer")); err == nil && u.String() != "" {
+				hlog.FromRequest(r).UpdateContext(func(c zerolog.Context) zerolog.Context {
+					return c.Str(fieldKey, redactURL(u))
+				})
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		redacted string
+	}{
+		{"/report/?tab=2", "/report/?tab=2"},
+		{"/report/?share=abc.def&tab=2", "/report/?share=REDACTED&tab=2"},
+		{"/.protodash/handoff?redirect_to=%2F&token=abc", "/.protodash/handoff?redirect_to=%2F&token=REDACTED"},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		assert.Equal(t, tt.redacted, redactURL(u))
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mozilla/protodash/jwt"
+	"github.com/rs/zerolog/hlog"
+)
+
+const backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// idpLogoutURL returns the URL ending the session at the identity provider,
+// which then redirects back to the base domain. Without a configured end
+// session endpoint, Auth0's logout endpoint is used.
+func (s *Server) idpLogoutURL(r *http.Request) string {
+	returnTo := requestScheme(r) + "://" + s.config.BaseDomain + "/"
+
+	uv := url.Values{}
+	uv.Set("client_id", s.config.OAuthClientID)
+
+	logoutURL := s.config.OAuthLogoutURL
+	if logoutURL == "" {
+		logoutURL = "https://" + s.config.OAuthDomain + "/v2/logout"
+		uv.Set("returnTo", returnTo)
+	} else {
+		uv.Set("post_logout_redirect_uri", returnTo)
+	}
+
+	return logoutURL + "?" + uv.Encode()
+}
+
+// newLogoutTokenVerifier returns a verifier for back-channel logout tokens
+// issued by the OAuth domain for our client.
+func newLogoutTokenVerifier(cfg *Config) *jwt.Verifier {
+	issuer := "https://" + cfg.OAuthDomain + "/"
+	keys := jwt.NewRemoteKeySet(issuer+".well-known/jwks.json", &http.Client{Timeout: cfg.ClientTimeout})
+	return jwt.NewVerifier(keys, issuer, cfg.OAuthClientID)
+}
+
+// verifyLogoutToken checks a back-channel logout token as described in
+// OpenID Connect Back-Channel Logout 1.0 and returns the subject to log out.
+func verifyLogoutToken(v *jwt.Verifier, token string) (string, error) {
+	claims, err := v.Verify(token)
+	if err != nil {
+		return "", err
+	}
+
+	events, _ := claims["events"].(map[string]interface{})
+	if _, ok := events[backchannelLogoutEvent]; !ok {
+		return "", errors.New("logout token is missing the back-channel logout event")
+	}
+	if _, ok := claims["nonce"]; ok {
+		return "", errors.New("logout token must not contain a nonce")
+	}
+	if claims.Subject() == "" {
+		return "", errors.New("logout token is missing the subject")
+	}
+
+	return claims.Subject(), nil
+}
+
+// authBackchannelLogout receives logout tokens from the identity provider and
+// revokes every session of the user that logged out.
+func (s *Server) authBackchannelLogout(v *jwt.Verifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		sub, err := verifyLogoutToken(v, strings.TrimSpace(r.PostFormValue("logout_token")))
+		if err != nil {
+			hlog.FromRequest(r).Warn().Err(err).Msg("rejected logout token")
+			http.Error(w, "Invalid Logout Token", http.StatusBadRequest)
+			return
+		}
+
+		revoker, ok := s.sessionStore.(sessionRevoker)
+		if !ok {
+			http.Error(w, "Session Store Does Not Support Revocation", http.StatusNotImplemented)
+			return
+		}
+
+		n, err := revoker.RevokeUser(sub)
+		if err != nil {
+			hlog.FromRequest(r).Error().Err(err).Send()
+			http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		hlog.FromRequest(r).Info().
+			Str("user", sub).
+			Int("revoked", n).
+			Msg("back-channel logout")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mozilla/protodash/jwt"
+	"github.com/mozilla/protodash/sessionstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func signTestJWT(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	assert.NoError(t, err)
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestIdPLogoutURL(t *testing.T) {
+	s := newTestServer()
+	s.config.OAuthDomain = "auth.example.com"
+	s.config.OAuthClientID = "client"
+
+	r := httptest.NewRequest("GET", "/auth/logout", nil)
+	u, _ := url.Parse(s.idpLogoutURL(r))
+	assert.Equal(t, "auth.example.com", u.Host)
+	assert.Equal(t, "/v2/logout", u.Path)
+	assert.Equal(t, "http://example.com/", u.Query().Get("returnTo"))
+	assert.Equal(t, "client", u.Query().Get("client_id"))
+
+	s.config.OAuthLogoutURL = "https://idp.example.com/logout"
+	r.Header.Set("X-Forwarded-Proto", "https")
+	u, _ = url.Parse(s.idpLogoutURL(r))
+	assert.Equal(t, "idp.example.com", u.Host)
+	assert.Equal(t, "https://example.com/", u.Query().Get("post_logout_redirect_uri"))
+}
+
+func TestBackchannelLogout(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	v := jwt.NewVerifier(jwt.StaticKeySet{"k1": &key.PublicKey}, "https://auth.example.com/", "client")
+
+	store := sessionstore.New(sessionstore.NewMemoryBackend(), []byte("secret"))
+	store.UserKey = "current_user_id"
+	s := newTestServer()
+	s.sessionStore = store
+
+	// log a user in
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	session, _ := store.New(r, sessionName)
+	session.Values["current_user_id"] = "user-1"
+	assert.NoError(t, session.Save(r, w))
+	cookie := w.Result().Cookies()[0]
+
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":    "https://auth.example.com/",
+			"aud":    "client",
+			"sub":    "user-1",
+			"iat":    time.Now().Unix(),
+			"exp":    time.Now().Add(time.Minute).Unix(),
+			"events": map[string]interface{}{backchannelLogoutEvent: map[string]interface{}{}},
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	post := func(token string) int {
+		r := httptest.NewRequest("POST", "/auth/backchannel-logout", strings.NewReader(url.Values{"logout_token": {token}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		s.authBackchannelLogout(v).ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post(signTestJWT(t, key, claims(map[string]interface{}{"events": nil}))))
+	assert.Equal(t, http.StatusBadRequest, post(signTestJWT(t, key, claims(map[string]interface{}{"nonce": "n"}))))
+	assert.Equal(t, http.StatusBadRequest, post(signTestJWT(t, key, claims(map[string]interface{}{"aud": "other"}))))
+	assert.Equal(t, http.StatusOK, post(signTestJWT(t, key, claims(nil))))
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookie)
+	session, _ = store.New(r, sessionName)
+	assert.Empty(t, session.Values)
+}
@@ -1,18 +1,24 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"html/template"
+	"io"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/gobuffalo/flect"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
+	"github.com/justinas/alice"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
 	"github.com/markbates/goth/providers/auth0"
+	"github.com/mozilla/protodash/audit"
 	"github.com/mozilla/protodash/pkce"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
@@ -25,46 +31,75 @@ func main() {
 		log.Panic().Err(err).Send()
 	}
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(validateCommand(cfg, os.Args[2:]))
+		case "schema":
+			os.Exit(schemaCommand(os.Args[2:]))
+		}
+	}
+
 	s := &Server{config: cfg}
 
 	// configure logging
 	configureLogging(cfg.LogLevel)
 
-	// load dashboard configs
-	dashboards, err := loadDashboards(cfg.ConfigFile, cfg)
+	// open the audit log
+	s.audit, err = audit.New(cfg.AuditSink, &http.Client{Timeout: cfg.ClientTimeout})
 	if err != nil {
 		log.Fatal().Err(err).Send()
 	}
-
-	// parse index template
-	tmpl, err := template.ParseFiles("index.gohtml")
-	if err != nil {
-		log.Fatal().Err(err).Send()
+	if webhook, ok := s.audit.(*audit.WebhookSink); ok {
+		webhook.OnError = func(err error, events []*audit.Event) {
+			log.Error().Err(err).Int("events", len(events)).Msg("failed to deliver audit events")
+		}
 	}
 
-	// create chain with http loggin
-	public := newLoggingChain()
-	private := public
+	if cfg.OAuthEnabled && cfg.ProxyAuth != "" {
+		log.Fatal().Msg("proxy authentication cannot be combined with OAuth")
+	}
 
-	r := mux.NewRouter()
-	r.StrictSlash(true)
+	// configure authentication through an upstream proxy if enabled
+	if cfg.ProxyAuth != "" {
+		s.proxyAuth, err = newProxyAuth(cfg)
+		if err != nil {
+			log.Fatal().Err(err).Send()
+		}
 
-	bd := cfg.BaseDomain
-	bdr := r.Host(bd).Subrouter()
+		log.Info().Msgf("enabling authentication with %s proxy mode", cfg.ProxyAuth)
+	}
 
 	// configure authentication if enabled
 	if cfg.OAuthEnabled {
+		// the gothic store only holds the state of in-progress logins
 		cookieStore := sessions.NewCookieStore([]byte(cfg.SessionSecret))
 		cookieStore.Options.HttpOnly = true
+		cookieStore.Options.SameSite = http.SameSiteLaxMode
+		cookieStore.MaxAge(int(cfg.OAuthFlowTimeout / time.Second))
 		parts := strings.Split(cfg.BaseDomain, ":")
 		cookieStore.Options.Domain = parts[0]
 		gothic.Store = cookieStore
-		s.sessionStore = cookieStore
+
+		s.sessionStore, err = newSessionStore(cfg)
+		if err != nil {
+			log.Fatal().Err(err).Send()
+		}
+		log.Info().Msgf("using %s session store", cfg.SessionStore)
+
+		pkceOpts := []pkce.Option{
+			pkce.WithTimeout(cfg.ClientTimeout),
+			pkce.WithFlowTTL(cfg.OAuthFlowTimeout),
+		}
+		for key, value := range cfg.OAuthAuthParams {
+			pkceOpts = append(pkceOpts, pkce.WithAuthParam(key, value))
+		}
 
 		pkceProvider := pkce.New(
 			cfg.OAuthClientID,
 			cfg.OAuthRedirectURI,
 			cfg.OAuthDomain,
+			pkceOpts...,
 		)
 
 		auth0Provider := auth0.New(
@@ -93,20 +128,111 @@ func main() {
 
 		log.Info().Msgf("enabling authentication with %s provider", providerName)
 
-		bdr.Handle("/auth/login", public.Then(s.authLogin())).Methods("GET")
-		bdr.Handle("/auth/callback", public.Then(s.authCallback())).Methods("GET")
-		bdr.Handle("/auth/logout", public.Then(s.authLogout())).Methods("GET")
+		s.bearerVerifier, err = newBearerVerifier(cfg)
+		if err != nil {
+			log.Fatal().Err(err).Send()
+		}
+		if s.bearerVerifier != nil {
+			log.Info().Msgf("accepting bearer tokens issued by %s", cfg.BearerIssuer)
+		}
+
+		if cfg.OAuthBackchannelLogout {
+			if _, ok := s.sessionStore.(sessionRevoker); !ok {
+				log.Fatal().Msg("back-channel logout requires a server-side session store")
+			}
+			s.logoutVerifier = newLogoutTokenVerifier(cfg)
+		}
+	}
+
+	// the GCS client is shared by the dashboards of every config reload
+	s.client, err = cfg.HTTPClient()
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
 
+	if cfg.Maintenance {
+		s.maintenance.set("", &maintenance{Message: cfg.MaintenanceMessage})
+	}
+
+	// parse the page templates
+	s.tmpl, err = loadTemplates(cfg.TemplateDir, cfg.BaseDomain)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+
+	// load dashboard configs and build the router serving them
+	s.configSource = newConfigSource(cfg.ConfigFile, s.client, &http.Client{Timeout: cfg.ClientTimeout})
+	version, err := s.reload("")
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+	go s.watchConfig(version)
+
+	if err = s.listenAndServe(); err != nil {
+		log.Fatal().Err(err).Send()
+	}
+}
+
+// routes builds the router serving the dashboards.
+func (s *Server) routes(dashboards []*Dash) *mux.Router {
+	cfg := s.config
+
+	// create chain with http loggin
+	public := newLoggingChain()
+	private := public
+	if cfg.AuthEnabled() {
 		private = public.Append(s.requireAuth)
 	}
 
-	// iterate over the dashboards and mount them
+	r := mux.NewRouter()
+	r.StrictSlash(true)
+
+	bd := cfg.BaseDomain
+	bdr := r.Host(bd).Subrouter()
+
+	domains := customDomains(dashboards)
+
+	bdr.PathPrefix(staticPath).Handler(public.Then(staticHandler(cfg.TemplateDir))).Methods("GET", "HEAD")
+
+	if cfg.OAuthEnabled {
+		bdr.Handle("/auth/login", public.Then(s.authLogin(domains))).Methods("GET")
+		bdr.Handle("/auth/callback", public.Then(s.authCallback(domains))).Methods("GET")
+		bdr.Handle("/auth/logout", public.Then(s.authLogout())).Methods("GET")
+
+		if s.logoutVerifier != nil {
+			bdr.Handle("/auth/backchannel-logout", public.Then(s.authBackchannelLogout(s.logoutVerifier))).Methods("POST")
+		}
+	}
+
+	// mount the admin API if an admin token or admins are configured
+	if cfg.AdminToken != "" || len(cfg.Admins) > 0 {
+		admin := public.Append(s.requireAdmin)
+		bdr.Handle("/admin/sessions/revoke", admin.Then(s.adminRevokeSessions())).Methods("POST")
+
+		bdr.Handle("/admin/maintenance", admin.Then(s.adminMaintenance(dashboards))).Methods("GET")
+		bdr.Handle("/admin/maintenance", admin.Then(s.adminStartMaintenance(dashboards))).Methods("POST")
+		bdr.Handle("/admin/maintenance/stop", admin.Then(s.adminStopMaintenance(dashboards))).Methods("POST")
+
+		if cfg.OAuthEnabled {
+			bdr.Handle("/admin/impersonate", admin.Then(s.adminImpersonate())).Methods("POST")
+			bdr.Handle("/admin/impersonate", private.Then(s.adminStartImpersonating())).Methods("GET")
+			bdr.Handle("/admin/impersonate/stop", public.Then(s.adminStopImpersonating())).Methods("POST")
+		}
+	}
+
+	// mount the share link endpoint if authentication is enabled
+	if cfg.AuthEnabled() && len(s.shareKey()) > 0 {
+		bdr.Handle("/share", private.Then(s.shareCreate(dashboards))).Methods("POST")
+	}
+
+	// mount the dashboard catalog API
+	bdr.Handle("/api/dashboards", public.Then(s.apiDashboards(dashboards))).Methods("GET")
+
+	// iterate over the dashboards and mount them, after the fixed routes so
+	// that they can't shadow them
 	for _, dashboard := range dashboards {
 		log.Info().Msgf("mounting %s at /%s/", dashboard.Name, dashboard.Slug)
-		chain := private
-		if dashboard.Public {
-			chain = public
-		}
+		chain := s.dashboardChain(public, dashboard)
 
 		sd := dashboard.Slug + "." + cfg.BaseDomain
 		bdp := "/" + dashboard.Slug + "/"
@@ -137,14 +263,49 @@ func main() {
 
 		sdghr.Handle(sdp, sdh)
 		sdghr.PathPrefix(sdp).Handler(sdh)
+
+		// serve the dashboard on its custom domains
+		for _, domain := range dashboard.Domains {
+			log.Info().Msgf("mounting %s at %s", dashboard.Name, domain)
+			cdr := r.Host(domain).Subrouter()
+			if cfg.OAuthEnabled {
+				cdr.Handle(handoffPath, public.Then(s.authHandoff())).Methods("GET")
+			}
+			cdr.Methods("GET", "HEAD").PathPrefix(sdp).Handler(chain.Then(dashboard.Handler(sdp)))
+		}
+
+		// redirect the previous slugs of the dashboard
+		for _, alias := range dashboard.Aliases {
+			ap := "/" + alias + "/"
+			bdah := public.Then(redirectToDashboard(dashboard, ap))
+			bdghr.Handle(ap, bdah)
+			bdghr.PathPrefix(ap).Handler(bdah)
+
+			if dnsLabel.MatchString(alias) {
+				sdah := public.Then(redirectToDashboard(dashboard, sdp))
+				r.Host(alias+"."+bd).Methods("GET", "HEAD").Handler(sdah)
+			}
+		}
 	}
 
 	// mount the index function to "/"
-	bdr.Handle("/", public.Then(s.index(dashboards, tmpl))).Methods("GET")
+	bdr.Handle("/", public.Append(s.checkMaintenance(nil)).Then(s.index(dashboards))).Methods("GET")
 
-	if err = http.ListenAndServe(cfg.Listen, r); err != nil {
-		log.Fatal().Err(err).Send()
+	return r
+}
+
+// dashboardChain appends the middleware guarding the dashboard to public. The
+// maintenance check comes before authentication so that every visitor learns
+// about it, admins are recognized from their credentials there.
+func (s *Server) dashboardChain(public alice.Chain, d *Dash) alice.Chain {
+	chain := public.Append(s.auditAccess(d), s.checkMaintenance(d))
+	switch {
+	case d.BasicAuth != nil:
+		chain = chain.Append(s.acceptShareLinks(d), s.requireBasicAuth(d))
+	case !d.Public && s.config.AuthEnabled():
+		chain = chain.Append(s.acceptShareLinks(d), s.requireAuth)
 	}
+	return chain.Append(s.authorize(d), s.checkExpiry(d))
 }
 
 type modifyPathFn func(path string) string
@@ -156,6 +317,19 @@ func redirectToDomain(domain string, fn modifyPathFn) http.HandlerFunc {
 	}
 }
 
+// redirectToDashboard permanently redirects to the dashboard, keeping the path
+// after prefix and the query.
+func redirectToDashboard(d *Dash, prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := *r.URL
+		u.Scheme = ""
+		u.Host = ""
+		u.Path = strings.TrimPrefix(r.URL.Path, prefix)
+		u.RawPath = ""
+		http.Redirect(w, r, d.url()+u.String(), http.StatusMovedPermanently)
+	}
+}
+
 func addPrefix(prefix string) modifyPathFn {
 	return func(path string) string {
 		return prefix + strings.TrimPrefix(path, "/")
@@ -170,65 +344,207 @@ func stripPrefix(prefix string) modifyPathFn {
 
 type indexData struct {
 	Dashboards []*Dash
-	User       *goth.User
+	Groups     []*dashboardGroup
+	Query      dashboardQuery
+	Tags       []string
+	Teams      []string
+	User       *User
+	IsAdmin    bool
+	Accessible map[string]bool
+	Updated    map[string]time.Time
 	Config     *Config
 }
 
-func (s *Server) index(dashboards []*Dash, tmpl *template.Template) http.HandlerFunc {
+// listDashboards returns the dashboards listed for the user, along with
+// whether the user can access each of them. Dashboards with basic auth count
+// as accessible since anyone may have their credentials, others are only
+// listed when PROTODASH_SHOW_PRIVATE is set.
+func (s *Server) listDashboards(dashboards []*Dash, user *User) ([]*Dash, map[string]bool) {
+	var listed []*Dash
+	accessible := make(map[string]bool, len(dashboards))
+
+	// archived and long expired dashboards are no longer listed
+	now := time.Now()
+	for _, d := range dashboards {
+		if d.lifecycle(now) == gone {
+			continue
+		}
+		accessible[d.Slug] = s.canAccess(d, user) || d.BasicAuth != nil
+		if accessible[d.Slug] || s.config.ShowPrivate {
+			listed = append(listed, d)
+		}
+	}
+
+	return listed, accessible
+}
+
+func (s *Server) index(dashboards []*Dash) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// return 404 if not the root
 		if r.URL.Path != "/" {
-			http.NotFound(w, r)
+			s.renderError(w, r, http.StatusNotFound)
 			return
 		}
 
 		data := &indexData{
-			Dashboards: dashboards,
-			Config:     s.config,
+			Config: s.config,
 		}
 
-		if s.config.OAuthEnabled {
-			session, _ := gothic.Store.Get(r, sessionName)
-			if email, ok := session.Values["current_user_email"]; ok {
-				data.User = &goth.User{
-					Email: email.(string),
-				}
+		if s.config.AuthEnabled() {
+			data.User, _ = s.currentUser(r)
+			if data.User != nil {
+				data.IsAdmin = s.isAdmin(data.User.real())
 			}
 		}
 
-		if err := tmpl.Execute(w, data); err != nil {
-			log.Error().Err(err).Send()
-			http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
-		}
+		listed, accessible := s.listDashboards(dashboards, data.User)
+		data.Accessible = accessible
+		data.Tags, data.Teams = dashboardFacets(listed)
+		data.Query = parseDashboardQuery(r)
+		data.Dashboards = data.Query.filter(listed)
+		data.Groups = groupDashboards(data.Dashboards, data.Query.GroupBy)
+		data.Updated = s.lastUpdated(r.Context(), accessibleDashboards(data.Dashboards, accessible))
+
+		s.renderPage(w, http.StatusOK, "index.gohtml", data)
 	})
 }
 
-func loadDashboards(name string, config *Config) ([]*Dash, error) {
-	cfgFile, err := os.Open(name)
+// accessibleDashboards returns the dashboards the user can access, the only
+// ones whose content details are shown.
+func accessibleDashboards(dashboards []*Dash, accessible map[string]bool) []*Dash {
+	var filtered []*Dash
+	for _, d := range dashboards {
+		if accessible[d.Slug] {
+			filtered = append(filtered, d)
+		}
+	}
+	return filtered
+}
+
+// parseDashboards loads the dashboards defined in the config files and
+// resolves their secrets. The dashboards fetch their files with client and
+// render their banners with tmpl.
+func parseDashboards(files []configFile, config *Config, client *http.Client, tmpl *template.Template) ([]*Dash, error) {
+	dashboards, err := decodeDashboards(files, config, newReferences(config))
 	if err != nil {
 		return nil, err
 	}
 
-	var dashboardMap map[string]*Dash
-	d := yaml.NewDecoder(cfgFile)
-	if err := d.Decode(&dashboardMap); err != nil {
-		return nil, err
+	var errs configErrors
+	for _, dashboard := range dashboards {
+		if dashboard.BasicAuth != nil {
+			if err := dashboard.BasicAuth.load(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: dashboard %s: %w", dashboard.file, dashboard.Slug, err))
+			}
+		}
+		dashboard.Client = client
+		dashboard.Templates = tmpl
+	}
+	if len(errs) > 0 {
+		return nil, errs
 	}
 
+	return dashboards, nil
+}
+
+// decodeDashboards strictly decodes and validates the dashboards defined in
+// the config files, a slug can only be defined once. References in config
+// values are resolved with refs, if given. Every problem is reported in the
+// returned configErrors.
+func decodeDashboards(files []configFile, config *Config, refs *references) ([]*Dash, error) {
 	var dashboards []*Dash
-	for slug, dashboard := range dashboardMap {
-		dashboard.Slug = slug
-		dashboard.Name = flect.Titleize(slug)
-		if dashboard.Bucket == "" {
-			dashboard.Bucket = config.DefaultBucket
-		}
-		dashboard.Config = config
-		dashboard.Client, err = config.HTTPClient()
-		if err != nil {
-			return nil, err
+	var errs configErrors
+	definedIn := make(map[string]string)
+
+	for _, f := range files {
+		var dashboardMap map[string]*Dash
+		dec := yaml.NewDecoder(bytes.NewReader(f.data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&dashboardMap); err != nil && err != io.EOF {
+			typeErr, ok := err.(*yaml.TypeError)
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: %w", f.name, err))
+				continue
+			}
+			for _, msg := range typeErr.Errors {
+				errs = append(errs, fmt.Errorf("%s: %s", f.name, msg))
+			}
+		}
+
+		slugs := make([]string, 0, len(dashboardMap))
+		for slug := range dashboardMap {
+			slugs = append(slugs, slug)
 		}
-		dashboards = append(dashboards, dashboard)
+		sort.Strings(slugs)
+
+		for _, slug := range slugs {
+			dashboard := dashboardMap[slug]
+			if dashboard == nil {
+				dashboard = &Dash{}
+			}
+
+			if other, ok := definedIn[slug]; ok {
+				errs = append(errs, fmt.Errorf("%s: dashboard %s is already defined in %s", f.name, slug, other))
+				continue
+			}
+			definedIn[slug] = f.name
+
+			if refs != nil {
+				for _, err := range refs.interpolate(dashboard) {
+					errs = append(errs, fmt.Errorf("%s: dashboard %s: %w", f.name, slug, err))
+				}
+			}
+
+			dashboard.Slug = slug
+			dashboard.Name = dashboard.Title
+			if dashboard.Name == "" {
+				dashboard.Name = flect.Titleize(slug)
+			}
+			dashboard.file = f.name
+			dashboard.Config = config
+			if dashboard.Bucket == "" {
+				dashboard.Bucket = config.DefaultBucket
+			}
+
+			for _, problem := range dashboard.validate() {
+				errs = append(errs, fmt.Errorf("%s: dashboard %s: %s", f.name, slug, problem))
+			}
+			dashboards = append(dashboards, dashboard)
+		}
+	}
+
+	// aliases can't shadow a dashboard or another alias
+	aliasOf := make(map[string]string)
+	for _, dashboard := range dashboards {
+		for _, alias := range dashboard.Aliases {
+			if file, ok := definedIn[alias]; ok {
+				errs = append(errs, fmt.Errorf("%s: dashboard %s: alias %s is a dashboard defined in %s", dashboard.file, dashboard.Slug, alias, file))
+				continue
+			}
+			if other, ok := aliasOf[alias]; ok {
+				errs = append(errs, fmt.Errorf("%s: dashboard %s: alias %s is already an alias of %s", dashboard.file, dashboard.Slug, alias, other))
+				continue
+			}
+			aliasOf[alias] = dashboard.Slug
+		}
+	}
+
+	// a custom domain serves a single dashboard
+	domainOf := make(map[string]string)
+	for _, dashboard := range dashboards {
+		for _, domain := range dashboard.Domains {
+			if other, ok := domainOf[domain]; ok {
+				errs = append(errs, fmt.Errorf("%s: dashboard %s: domain %s is already a domain of %s", dashboard.file, dashboard.Slug, domain, other))
+				continue
+			}
+			domainOf[domain] = dashboard.Slug
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
 	}
 
+	sortDashboards(dashboards)
 	return dashboards, nil
 }
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// maintenance describes why and since when a dashboard, or the whole server,
+// is unavailable.
+type maintenance struct {
+	Message    string        `json:"message,omitempty"`
+	Since      *time.Time    `json:"since,omitempty"`
+	RetryAfter time.Duration `json:"-"`
+}
+
+// maintenanceModes holds the maintenance modes set through the admin API, they
+// survive config reloads but not restarts.
+type maintenanceModes struct {
+	mu         sync.RWMutex
+	global     *maintenance
+	dashboards map[string]*maintenance
+}
+
+func (m *maintenanceModes) set(slug string, mode *maintenance) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if slug == "" {
+		m.global = mode
+		return
+	}
+	if m.dashboards == nil {
+		m.dashboards = make(map[string]*maintenance)
+	}
+	if mode == nil {
+		delete(m.dashboards, slug)
+		return
+	}
+	m.dashboards[slug] = mode
+}
+
+func (m *maintenanceModes) get(slug string) *maintenance {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if slug == "" {
+		return m.global
+	}
+	return m.dashboards[slug]
+}
+
+// maintenanceFor returns the maintenance mode the dashboard is in, if any. A
+// nil dashboard only checks the global maintenance mode.
+func (s *Server) maintenanceFor(d *Dash) *maintenance {
+	if mode := s.maintenance.get(""); mode != nil {
+		return mode
+	}
+	if d == nil {
+		return nil
+	}
+	return s.dashboardMaintenance(d)
+}
+
+// dashboardMaintenance returns the maintenance mode of the dashboard set
+// through the admin API or its config.
+func (s *Server) dashboardMaintenance(d *Dash) *maintenance {
+	if mode := s.maintenance.get(d.Slug); mode != nil {
+		return mode
+	}
+	if d.Maintenance {
+		return &maintenance{Message: d.MaintenanceMessage}
+	}
+	return nil
+}
+
+// requestFromAdmin returns whether the request comes from an admin, who can
+// still use dashboards in maintenance.
+func (s *Server) requestFromAdmin(r *http.Request) bool {
+	user := userFromContext(r.Context())
+	if user == nil && s.config.AuthEnabled() {
+		user, _ = s.currentUser(r)
+	}
+	return user != nil && s.isAdmin(user.real())
+}
+
+// checkMaintenance answers with 503 Service Unavailable while the dashboard,
+// or the whole server when d is nil, is in maintenance. Admins are let
+// through.
+func (s *Server) checkMaintenance(d *Dash) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mode := s.maintenanceFor(d)
+			if mode == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if s.requestFromAdmin(r) {
+				w.Header().Set("X-Protodash-Maintenance", "on")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			retryAfter := mode.RetryAfter
+			if retryAfter == 0 {
+				retryAfter = s.config.MaintenanceRetryAfter
+			}
+
+			w.Header().Set("Cache-Control", "no-store")
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+			s.renderPage(w, http.StatusServiceUnavailable, "maintenance.gohtml", struct {
+				Dash *Dash
+				*maintenance
+			}{d, mode})
+		})
+	}
+}
+
+type maintenanceStatus struct {
+	Global     *maintenance            `json:"global"`
+	Dashboards map[string]*maintenance `json:"dashboards"`
+}
+
+// adminMaintenance lists the maintenance modes of the server and dashboards.
+func (s *Server) adminMaintenance(dashboards []*Dash) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := maintenanceStatus{
+			Global:     s.maintenance.get(""),
+			Dashboards: make(map[string]*maintenance),
+		}
+		for _, d := range dashboards {
+			if mode := s.dashboardMaintenance(d); mode != nil {
+				status.Dashboards[d.Slug] = mode
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// adminStartMaintenance puts the dashboard given by the dashboard param, or
+// the whole server without it, into maintenance.
+func (s *Server) adminStartMaintenance(dashboards []*Dash) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := r.FormValue("dashboard")
+		if slug != "" && findDashboard(dashboards, slug) == nil {
+			http.Error(w, "Unknown Dashboard", http.StatusNotFound)
+			return
+		}
+
+		now := time.Now().UTC()
+		mode := &maintenance{
+			Message: r.FormValue("message"),
+			Since:   &now,
+		}
+		if value := r.FormValue("retry_after"); value != "" {
+			retryAfter, err := time.ParseDuration(value)
+			if err != nil || retryAfter <= 0 {
+				http.Error(w, "Invalid Retry After", http.StatusBadRequest)
+				return
+			}
+			mode.RetryAfter = retryAfter
+		}
+		s.maintenance.set(slug, mode)
+
+		hlog.FromRequest(r).Info().
+			Str("dashboard", slug).
+			Str("message", mode.Message).
+			Msg("started maintenance")
+
+		s.adminMaintenance(dashboards).ServeHTTP(w, r)
+	}
+}
+
+// adminStopMaintenance ends the maintenance mode of the dashboard given by the
+// dashboard param, or of the whole server without it. Dashboards in
+// maintenance through their config stay in maintenance.
+func (s *Server) adminStopMaintenance(dashboards []*Dash) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := r.FormValue("dashboard")
+		s.maintenance.set(slug, nil)
+
+		hlog.FromRequest(r).Info().
+			Str("dashboard", slug).
+			Msg("stopped maintenance")
+
+		s.adminMaintenance(dashboards).ServeHTTP(w, r)
+	}
+}
+
+func findDashboard(dashboards []*Dash, slug string) *Dash {
+	for _, d := range dashboards {
+		if d.Slug == slug {
+			return d
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/justinas/alice"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenance(t *testing.T) {
+	s := newTestServer()
+	s.config.OAuthEnabled = true
+	s.config.Admins = []string{"admin@example.com"}
+	s.config.AdminToken = "admin-token"
+	s.config.MaintenanceRetryAfter = 5 * time.Minute
+
+	report := &Dash{Name: "Report", Slug: "report", Public: true}
+	other := &Dash{Name: "Other", Slug: "other", Public: true, Maintenance: true, MaintenanceMessage: "Fixing numbers"}
+	dashboards := []*Dash{report, other}
+
+	serve := func(d *Dash, r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.checkMaintenance(d)(echoUser()).ServeHTTP(w, r)
+		return w
+	}
+
+	// maintenance from the config
+	w := serve(other, httptest.NewRequest("GET", "/other/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "300", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "Other is down for maintenance")
+	assert.Contains(t, w.Body.String(), "Fixing numbers")
+	assert.Equal(t, http.StatusOK, serve(report, httptest.NewRequest("GET", "/report/", nil)).Code)
+
+	// maintenance through the admin API
+	r := httptest.NewRequest("POST", "/admin/maintenance", strings.NewReader("dashboard=report&retry_after=1h"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Authorization", "Bearer admin-token")
+	w = httptest.NewRecorder()
+	s.requireAdmin(s.adminStartMaintenance(dashboards)).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var status maintenanceStatus
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	assert.Nil(t, status.Global)
+	assert.Len(t, status.Dashboards, 2)
+
+	w = serve(report, httptest.NewRequest("GET", "/report/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+
+	// admins are let through
+	admin := loginCookies(t, s, map[interface{}]interface{}{
+		"current_user_id":    "admin-1",
+		"current_user_email": "admin@example.com",
+	})
+	w = serve(report, withCookies(httptest.NewRequest("GET", "/report/", nil), admin))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "on", w.Header().Get("X-Protodash-Maintenance"))
+
+	// global maintenance covers the index page
+	s.maintenance.set("", &maintenance{})
+	assert.Equal(t, http.StatusServiceUnavailable, serve(nil, httptest.NewRequest("GET", "/", nil)).Code)
+
+	s.maintenance.set("", nil)
+	r = httptest.NewRequest("POST", "/admin/maintenance/stop?dashboard=report", nil)
+	s.adminStopMaintenance(dashboards).ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, http.StatusOK, serve(nil, httptest.NewRequest("GET", "/", nil)).Code)
+	assert.Equal(t, http.StatusOK, serve(report, httptest.NewRequest("GET", "/report/", nil)).Code)
+}
+
+func TestMaintenanceBeforeAuth(t *testing.T) {
+	s := newTestServer()
+	s.config.OAuthEnabled = true
+	s.config.RedirectToLogin = true
+	s.config.Admins = []string{"admin@example.com"}
+	s.config.MaintenanceRetryAfter = time.Minute
+
+	d := &Dash{Name: "Report", Slug: "report", Maintenance: true, MaintenanceMessage: "Fixing numbers"}
+	h := s.dashboardChain(alice.New(), d).Then(echoUser())
+
+	// anonymous visitors of a private dashboard learn about the maintenance
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/report/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "Fixing numbers")
+
+	// admins still get through authentication
+	admin := loginCookies(t, s, map[interface{}]interface{}{
+		"current_user_id":    "admin-1",
+		"current_user_email": "admin@example.com",
+	})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withCookies(httptest.NewRequest("GET", "/report/", nil), admin))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "admin-1", w.Body.String())
+}
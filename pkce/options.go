@@ -0,0 +1,90 @@
+package pkce
+
+import (
+	"net/http"
+	"time"
+)
+
+// Option configures a Provider created with New.
+type Option func(*Provider)
+
+// WithHTTPClient sets the client used for the token exchange and fetching the
+// user profile.
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *Provider) {
+		p.HTTPClient = client
+	}
+}
+
+// WithTimeout sets a timeout on every request the provider makes to the
+// identity provider.
+func WithTimeout(timeout time.Duration) Option {
+	return func(p *Provider) {
+		p.timeout = timeout
+	}
+}
+
+// WithFlowTTL sets how long the user has to complete an authorization flow.
+func WithFlowTTL(ttl time.Duration) Option {
+	return func(p *Provider) {
+		p.FlowTTL = ttl
+	}
+}
+
+// WithScopes sets the scopes requested, replacing the default openid,
+// profile and email scopes.
+func WithScopes(scopes ...string) Option {
+	return func(p *Provider) {
+		p.Config.Scopes = append([]string(nil), scopes...)
+	}
+}
+
+// WithEndpoints overrides the authorization, token and profile URLs derived
+// from the domain. Empty URLs are left unchanged.
+func WithEndpoints(authURL, tokenURL, profileURL string) Option {
+	return func(p *Provider) {
+		if authURL != "" {
+			p.Config.Endpoint.AuthURL = authURL
+		}
+		if tokenURL != "" {
+			p.Config.Endpoint.TokenURL = tokenURL
+		}
+		if profileURL != "" {
+			p.ProfileURL = profileURL
+		}
+	}
+}
+
+// WithIssuer sets the issuer of ID tokens, which is the domain by default.
+func WithIssuer(issuer string) Option {
+	return func(p *Provider) {
+		p.Issuer = issuer
+	}
+}
+
+// WithAuthParam adds an extra parameter to the authorization URL.
+func WithAuthParam(key, value string) Option {
+	return func(p *Provider) {
+		if p.AuthParams == nil {
+			p.AuthParams = make(map[string]string)
+		}
+		p.AuthParams[key] = value
+	}
+}
+
+// WithAudience requests an access token for the given API audience.
+func WithAudience(audience string) Option {
+	return WithAuthParam("audience", audience)
+}
+
+// WithPrompt sets the prompt parameter, e.g. "login" to force
+// re-authentication.
+func WithPrompt(prompt string) Option {
+	return WithAuthParam("prompt", prompt)
+}
+
+// WithConnection selects the identity provider connection to log in with,
+// skipping the provider's login page.
+func WithConnection(connection string) Option {
+	return WithAuthParam("connection", connection)
+}
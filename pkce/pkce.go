@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/markbates/goth"
 	"golang.org/x/oauth2"
@@ -18,10 +19,28 @@ const (
 	protocol    = "https://"
 )
 
+const (
+	defaultFlowTTL = 10 * time.Minute
+	// idTokenLeeway is the allowed clock skew when checking the expiry of ID
+	// tokens.
+	idTokenLeeway = time.Minute
+)
+
 type Provider struct {
 	*oauth2.Config
 	ProfileURL string
-	name       string
+	// HTTPClient is used for the token exchange and fetching the user
+	// profile, http.DefaultClient is used if nil.
+	HTTPClient *http.Client
+	// FlowTTL is how long the user has to complete an authorization flow
+	// once it has begun.
+	FlowTTL time.Duration
+	// AuthParams are extra parameters added to the authorization URL.
+	AuthParams map[string]string
+	// Issuer is the iss claim ID tokens must have.
+	Issuer  string
+	timeout time.Duration
+	name    string
 }
 
 type UserInfo struct {
@@ -31,7 +50,9 @@ type UserInfo struct {
 	UserID   string `json:"sub"`
 }
 
-func New(clientID, redirectURI, domain string, scopes ...string) *Provider {
+// New returns a provider for the given domain, requesting the openid, profile
+// and email scopes unless configured otherwise with opts.
+func New(clientID, redirectURI, domain string, opts ...Option) *Provider {
 	p := &Provider{
 		Config: &oauth2.Config{
 			ClientID:    clientID,
@@ -40,17 +61,23 @@ func New(clientID, redirectURI, domain string, scopes ...string) *Provider {
 				AuthURL:  protocol + domain + authPath,
 				TokenURL: protocol + domain + tokenPath,
 			},
+			Scopes: []string{"openid", "profile", "email"},
 		},
 		ProfileURL: protocol + domain + profilePath,
+		Issuer:     protocol + domain + "/",
+		FlowTTL:    defaultFlowTTL,
 		name:       "pkce",
 	}
-	if len(scopes) > 0 {
-		p.Config.Scopes = make([]string, len(scopes))
-		for i, scope := range scopes {
-			p.Config.Scopes[i] = scope
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.timeout > 0 {
+		client := &http.Client{}
+		if p.HTTPClient != nil {
+			*client = *p.HTTPClient
 		}
-	} else {
-		p.Config.Scopes = []string{"openid", "profile", "email"}
+		client.Timeout = p.timeout
+		p.HTTPClient = client
 	}
 	return p
 }
@@ -63,6 +90,8 @@ func (p *Provider) SetName(name string) {
 	p.name = name
 }
 
+// BeginAuth starts an authorization flow, binding the code verifier, state
+// and nonce to the returned session which expires after FlowTTL.
 func (p *Provider) BeginAuth(state string) (goth.Session, error) {
 	cv, err := codeVerifier()
 	if err != nil {
@@ -70,20 +99,40 @@ func (p *Provider) BeginAuth(state string) (goth.Session, error) {
 	}
 
 	cc := codeChallenge(cv)
+	opts := []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", cc),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
 
 	s := &Session{
-		AuthURL: p.Config.AuthCodeURL(
-			state,
-			oauth2.SetAuthURLParam("code_challenge", cc),
-			oauth2.SetAuthURLParam("code_challenge_method", "S256"),
-		),
-		CodeVerifier: cv,
+		CodeVerifier:  cv,
+		State:         state,
+		FlowExpiresAt: time.Now().Add(p.FlowTTL),
+	}
+
+	if p.isOpenID() {
+		if s.Nonce, err = nonce(); err != nil {
+			return nil, err
+		}
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", s.Nonce))
+	}
+
+	for key, value := range p.AuthParams {
+		opts = append(opts, oauth2.SetAuthURLParam(key, value))
 	}
 
+	s.AuthURL = p.Config.AuthCodeURL(state, opts...)
+
 	return s, nil
 }
 
+// FetchUser fetches the profile of the user the session was authorized for.
 func (p *Provider) FetchUser(session goth.Session) (goth.User, error) {
+	return p.FetchUserContext(context.Background(), session)
+}
+
+// FetchUserContext is FetchUser bound to ctx.
+func (p *Provider) FetchUserContext(ctx context.Context, session goth.Session) (goth.User, error) {
 	s := session.(*Session)
 	user := goth.User{
 		AccessToken:  s.AccessToken,
@@ -96,17 +145,14 @@ func (p *Provider) FetchUser(session goth.Session) (goth.User, error) {
 		return user, fmt.Errorf("%s cannot get user information without accessToken", p.Name())
 	}
 
-	req, err := http.NewRequest(http.MethodGet, p.ProfileURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.ProfileURL, nil)
 	if err != nil {
 		return user, err
 	}
 	req.Header.Set("Authorization", "Bearer "+s.AccessToken)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.client().Do(req)
 	if err != nil {
-		if resp.Body != nil {
-			resp.Body.Close()
-		}
 		return user, err
 	}
 	defer resp.Body.Close()
@@ -148,7 +194,7 @@ func (p *Provider) RefreshToken(refreshToken string) (*oauth2.Token, error) {
 	token := &oauth2.Token{
 		RefreshToken: refreshToken,
 	}
-	tokenSource := p.Config.TokenSource(context.Background(), token)
+	tokenSource := p.Config.TokenSource(p.context(context.Background()), token)
 	newToken, err := tokenSource.Token()
 	if err != nil {
 		return nil, err
@@ -159,3 +205,24 @@ func (p *Provider) RefreshToken(refreshToken string) (*oauth2.Token, error) {
 func (p *Provider) RefreshTokenAvailable() bool {
 	return true
 }
+
+func (p *Provider) client() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// context returns ctx carrying the HTTP client for the oauth2 package.
+func (p *Provider) context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, p.client())
+}
+
+func (p *Provider) isOpenID() bool {
+	for _, scope := range p.Config.Scopes {
+		if scope == "openid" {
+			return true
+		}
+	}
+	return false
+}
@@ -2,9 +2,12 @@ package pkce_test
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
-	"github.com/jarcoal/httpmock"
 	"github.com/markbates/goth"
 	"github.com/mozilla/protodash/pkce"
 	"github.com/stretchr/testify/assert"
@@ -23,6 +26,7 @@ func TestNew(t *testing.T) {
 	assert.Equal(t, pkceClientID, p.ClientID)
 	assert.Equal(t, expectedProfileURL, p.ProfileURL)
 	assert.Equal(t, pkceRedirectURI, p.RedirectURL)
+	assert.Equal(t, "https://"+pkceDomain+"/", p.Issuer)
 }
 
 func TestImplementsProvider(t *testing.T) {
@@ -55,9 +59,6 @@ func TestUnmarshalSession(t *testing.T) {
 }
 
 func TestFetchUser(t *testing.T) {
-	httpmock.Activate()
-	defer httpmock.DeactivateAndReset()
-
 	sampleResp := `{
   		"email_verified": false,
   		"email": "test.account@userinfo.com",
@@ -78,13 +79,13 @@ func TestFetchUser(t *testing.T) {
   		"sub": "auth0|58454..."
 	}`
 
-	httpmock.RegisterResponder(
-		"GET",
-		fmt.Sprintf("https://%s/userinfo", pkceDomain),
-		httpmock.NewStringResponder(200, sampleResp),
-	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		w.Write([]byte(sampleResp))
+	}))
+	defer ts.Close()
 
-	p := provider()
+	p := provider(pkce.WithEndpoints("", "", ts.URL))
 
 	session, _ := p.BeginAuth("test_state")
 	s := session.(*pkce.Session)
@@ -99,10 +100,57 @@ func TestFetchUser(t *testing.T) {
 	assert.Equal(t, "token", u.AccessToken)
 }
 
-func provider() *pkce.Provider {
+func TestFetchUserTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	p := provider(
+		pkce.WithEndpoints("", "", ts.URL),
+		pkce.WithTimeout(10*time.Millisecond),
+	)
+
+	_, err := p.FetchUser(&pkce.Session{AccessToken: "token"})
+	assert.Error(t, err)
+}
+
+func TestOptions(t *testing.T) {
+	client := &http.Client{}
+	p := provider(
+		pkce.WithHTTPClient(client),
+		pkce.WithScopes("openid"),
+		pkce.WithEndpoints("https://auth.example.com/authorize", "https://auth.example.com/token", ""),
+		pkce.WithAudience("https://api.example.com"),
+		pkce.WithPrompt("login"),
+		pkce.WithConnection("google-oauth2"),
+		pkce.WithFlowTTL(time.Minute),
+		pkce.WithIssuer("https://auth.example.com/"),
+	)
+
+	assert.Equal(t, client, p.HTTPClient)
+	assert.Equal(t, []string{"openid"}, p.Scopes)
+	assert.Equal(t, "https://auth.example.com/token", p.Endpoint.TokenURL)
+	assert.Equal(t, fmt.Sprintf("https://%s/userinfo", pkceDomain), p.ProfileURL)
+	assert.Equal(t, time.Minute, p.FlowTTL)
+	assert.Equal(t, "https://auth.example.com/", p.Issuer)
+
+	session, err := p.BeginAuth("test_state")
+	assert.NoError(t, err)
+
+	u, _ := url.Parse(session.(*pkce.Session).AuthURL)
+	assert.Equal(t, "auth.example.com", u.Host)
+	assert.Equal(t, "https://api.example.com", u.Query().Get("audience"))
+	assert.Equal(t, "login", u.Query().Get("prompt"))
+	assert.Equal(t, "google-oauth2", u.Query().Get("connection"))
+	assert.Equal(t, "openid", u.Query().Get("scope"))
+}
+
+func provider(opts ...pkce.Option) *pkce.Provider {
 	return pkce.New(
 		pkceClientID,
 		pkceRedirectURI,
 		pkceDomain,
+		opts...,
 	)
 }
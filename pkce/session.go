@@ -2,20 +2,25 @@ package pkce
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"time"
 
 	"github.com/markbates/goth"
+	"github.com/mozilla/protodash/jwt"
 	"golang.org/x/oauth2"
 )
 
 type Session struct {
-	AuthURL      string
-	AccessToken  string
-	RefreshToken string
-	ExpiresAt    time.Time
-	CodeVerifier string
+	AuthURL       string
+	AccessToken   string
+	RefreshToken  string
+	ExpiresAt     time.Time
+	CodeVerifier  string
+	State         string
+	Nonce         string
+	FlowExpiresAt time.Time
 }
 
 // GetAuthURL returns the URL for the authentication end-point for the provider.
@@ -35,10 +40,26 @@ func (s *Session) Marshal() string {
 // Authorize should validate the data from the provider and return an access token
 // that can be stored for later access to the provider.
 func (s *Session) Authorize(provider goth.Provider, params goth.Params) (string, error) {
+	return s.AuthorizeContext(context.Background(), provider, params)
+}
+
+// AuthorizeContext is Authorize bound to ctx. The flow must not have expired,
+// the state must match the one the flow began with, and the ID token must
+// come from the issuer, be unexpired and carry the nonce sent in the
+// authorization request.
+func (s *Session) AuthorizeContext(ctx context.Context, provider goth.Provider, params goth.Params) (string, error) {
 	p := provider.(*Provider)
 
+	if !s.FlowExpiresAt.IsZero() && time.Now().After(s.FlowExpiresAt) {
+		return "", errors.New("authorization flow has expired")
+	}
+
+	if s.State != "" && subtle.ConstantTimeCompare([]byte(params.Get("state")), []byte(s.State)) != 1 {
+		return "", errors.New("state mismatch")
+	}
+
 	token, err := p.Config.Exchange(
-		context.Background(),
+		p.context(ctx),
 		params.Get("code"),
 		oauth2.SetAuthURLParam("code_verifier", s.CodeVerifier),
 	)
@@ -50,6 +71,12 @@ func (s *Session) Authorize(provider goth.Provider, params goth.Params) (string,
 		return "", errors.New("invalid token received from provider")
 	}
 
+	if s.Nonce != "" {
+		if err = s.verifyIDToken(p, token); err != nil {
+			return "", err
+		}
+	}
+
 	s.AccessToken = token.AccessToken
 	s.RefreshToken = token.RefreshToken
 	s.ExpiresAt = token.Expiry
@@ -57,6 +84,41 @@ func (s *Session) Authorize(provider goth.Provider, params goth.Params) (string,
 	return token.AccessToken, nil
 }
 
+// verifyIDToken checks the ID token received alongside the access token. As
+// it was received directly from the token endpoint over TLS, its signature is
+// not checked (OpenID Connect Core 1.0, section 3.1.3.7).
+func (s *Session) verifyIDToken(p *Provider, token *oauth2.Token) error {
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		return errors.New("no id_token received from provider")
+	}
+
+	claims, err := jwt.ParseUnverified(idToken)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.String("nonce")), []byte(s.Nonce)) != 1 {
+		return errors.New("id_token nonce mismatch")
+	}
+
+	if claims.String("iss") != p.Issuer {
+		return errors.New("id_token issuer mismatch")
+	}
+
+	exp := claims.Time("exp")
+	if exp.IsZero() || time.Now().After(exp.Add(idTokenLeeway)) {
+		return errors.New("id_token is expired")
+	}
+
+	for _, aud := range claims.Strings("aud") {
+		if aud == p.Config.ClientID {
+			return nil
+		}
+	}
+	return errors.New("id_token audience mismatch")
+}
+
 func (p *Provider) UnmarshalSession(data string) (goth.Session, error) {
 	s := &Session{}
 	if err := json.Unmarshal([]byte(data), s); err != nil {
@@ -1,7 +1,14 @@
 package pkce_test
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/markbates/goth"
 	"github.com/mozilla/protodash/pkce"
@@ -27,5 +34,142 @@ func TestGetAuthURL(t *testing.T) {
 func TestMarshal(t *testing.T) {
 	s := &pkce.Session{}
 	data := s.Marshal()
-	assert.Equal(t, `{"AuthURL":"","AccessToken":"","RefreshToken":"","ExpiresAt":"0001-01-01T00:00:00Z","CodeVerifier":""}`, data)
+	assert.Equal(t, `{"AuthURL":"","AccessToken":"","RefreshToken":"","ExpiresAt":"0001-01-01T00:00:00Z","CodeVerifier":"","State":"","Nonce":"","FlowExpiresAt":"0001-01-01T00:00:00Z"}`, data)
+}
+
+func idToken(claims map[string]interface{}) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`))
+	payload, _ := json.Marshal(claims)
+	return header + "." + base64.RawURLEncoding.EncodeToString(payload) + ".c2ln"
+}
+
+// idTokenClaims returns valid ID token claims for the session, with the
+// overrides applied.
+func idTokenClaims(s *pkce.Session, overrides map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"iss":   "https://" + pkceDomain + "/",
+		"aud":   pkceClientID,
+		"nonce": s.Nonce,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range overrides {
+		claims[k] = v
+	}
+	return claims
+}
+
+func tokenServer(t *testing.T, claims map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEmpty(t, r.FormValue("code_verifier"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token","token_type":"Bearer","expires_in":3600,"id_token":"%s"}`, idToken(claims))
+	}))
+}
+
+func beginAuth(t *testing.T, p *pkce.Provider) *pkce.Session {
+	session, err := p.BeginAuth("test_state")
+	assert.NoError(t, err)
+	return session.(*pkce.Session)
+}
+
+func TestBeginAuthBindsStateAndNonce(t *testing.T) {
+	s := beginAuth(t, provider())
+
+	u, err := url.Parse(s.AuthURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "test_state", s.State)
+	assert.NotEmpty(t, s.Nonce)
+	assert.Equal(t, s.Nonce, u.Query().Get("nonce"))
+	assert.True(t, s.FlowExpiresAt.After(time.Now()))
+}
+
+func TestAuthorize(t *testing.T) {
+	p := provider()
+	s := beginAuth(t, p)
+
+	ts := tokenServer(t, idTokenClaims(s, nil))
+	defer ts.Close()
+	p.Config.Endpoint.TokenURL = ts.URL
+
+	token, err := s.Authorize(p, url.Values{"code": {"code"}, "state": {"test_state"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token)
+	assert.Equal(t, "token", s.AccessToken)
+}
+
+func TestAuthorizeRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims func(s *pkce.Session) map[string]interface{}
+		state  string
+		modify func(s *pkce.Session)
+	}{
+		{
+			name: "nonce mismatch",
+			claims: func(s *pkce.Session) map[string]interface{} {
+				return idTokenClaims(s, map[string]interface{}{"nonce": "other"})
+			},
+			state: "test_state",
+		},
+		{
+			name: "audience mismatch",
+			claims: func(s *pkce.Session) map[string]interface{} {
+				return idTokenClaims(s, map[string]interface{}{"aud": "other"})
+			},
+			state: "test_state",
+		},
+		{
+			name: "issuer mismatch",
+			claims: func(s *pkce.Session) map[string]interface{} {
+				return idTokenClaims(s, map[string]interface{}{"iss": "https://evil.example.com/"})
+			},
+			state: "test_state",
+		},
+		{
+			name: "expired id_token",
+			claims: func(s *pkce.Session) map[string]interface{} {
+				return idTokenClaims(s, map[string]interface{}{"exp": time.Now().Add(-2 * time.Minute).Unix()})
+			},
+			state: "test_state",
+		},
+		{
+			name: "id_token without exp",
+			claims: func(s *pkce.Session) map[string]interface{} {
+				claims := idTokenClaims(s, nil)
+				delete(claims, "exp")
+				return claims
+			},
+			state: "test_state",
+		},
+		{
+			name: "state mismatch",
+			claims: func(s *pkce.Session) map[string]interface{} {
+				return idTokenClaims(s, nil)
+			},
+			state: "other_state",
+		},
+		{
+			name: "expired flow",
+			claims: func(s *pkce.Session) map[string]interface{} {
+				return idTokenClaims(s, nil)
+			},
+			state:  "test_state",
+			modify: func(s *pkce.Session) { s.FlowExpiresAt = time.Now().Add(-time.Minute) },
+		},
+	}
+
+	for _, tt := range tests {
+		p := provider()
+		s := beginAuth(t, p)
+		if tt.modify != nil {
+			tt.modify(s)
+		}
+
+		ts := tokenServer(t, tt.claims(s))
+		p.Config.Endpoint.TokenURL = ts.URL
+
+		_, err := s.Authorize(p, url.Values{"code": {"code"}, "state": {tt.state}})
+		assert.Error(t, err, tt.name)
+		ts.Close()
+	}
 }
@@ -16,6 +16,16 @@ func codeVerifier() (string, error) {
 	return str, nil
 }
 
+func nonce() (string, error) {
+	bs := make([]byte, 16)
+	_, err := rand.Read(bs)
+	if err != nil {
+		return "", err
+	}
+	str := base64.RawURLEncoding.EncodeToString(bs)
+	return str, nil
+}
+
 func codeChallenge(verifier string) string {
 	bs := sha256.Sum256([]byte(verifier))
 	str := base64.RawURLEncoding.EncodeToString(bs[:])
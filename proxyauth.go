@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mozilla/protodash/jwt"
+)
+
+const (
+	proxyAuthAssertion = "assertion"
+	proxyAuthHeader    = "header"
+)
+
+// proxyAuth derives the user from headers set by an authenticating proxy in
+// front of protodash, such as Google IAP or oauth2-proxy.
+type proxyAuth struct {
+	mode         string
+	header       string
+	userHeader   string
+	groupsHeader string
+	groupsClaim  string
+	verifier     *jwt.Verifier
+	trusted      []*net.IPNet
+}
+
+func newProxyAuth(cfg *Config) (*proxyAuth, error) {
+	p := &proxyAuth{
+		mode:         cfg.ProxyAuth,
+		header:       cfg.ProxyAuthHeader,
+		userHeader:   cfg.ProxyAuthUserHeader,
+		groupsHeader: cfg.ProxyAuthGroupsHeader,
+		groupsClaim:  cfg.GroupsClaim,
+	}
+
+	switch p.mode {
+	case proxyAuthAssertion:
+		if p.header == "" {
+			p.header = "X-Goog-IAP-JWT-Assertion"
+		}
+		// IAP assertions of every project share the issuer and keys, only
+		// the audience tells they were made for protodash
+		if cfg.ProxyAuthAudience == "" {
+			return nil, fmt.Errorf("proxy auth mode %q requires an audience", p.mode)
+		}
+		keys := jwt.NewRemoteKeySet(cfg.ProxyAuthJWKSURL, &http.Client{Timeout: cfg.ClientTimeout})
+		p.verifier = jwt.NewVerifier(keys, cfg.ProxyAuthIssuer, cfg.ProxyAuthAudience)
+	case proxyAuthHeader:
+		if p.header == "" {
+			p.header = "X-Forwarded-Email"
+		}
+		if len(cfg.ProxyAuthTrustedCIDRs) == 0 {
+			return nil, fmt.Errorf("proxy auth mode %q requires trusted CIDRs", p.mode)
+		}
+		for _, cidr := range cfg.ProxyAuthTrustedCIDRs {
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, err
+			}
+			p.trusted = append(p.trusted, ipNet)
+		}
+	default:
+		return nil, fmt.Errorf("unknown proxy auth mode %q", p.mode)
+	}
+
+	return p, nil
+}
+
+// user returns the user asserted by the proxy, or nil if the request carries
+// no identity.
+func (p *proxyAuth) user(r *http.Request) (*User, error) {
+	value := r.Header.Get(p.header)
+	if value == "" {
+		return nil, nil
+	}
+
+	if p.mode == proxyAuthAssertion {
+		claims, err := p.verifier.Verify(value)
+		if err != nil {
+			return nil, err
+		}
+		return &User{
+			ID:     claims.Subject(),
+			Email:  claims.String("email"),
+			Groups: claims.Strings(p.groupsClaim),
+			Method: "proxy",
+		}, nil
+	}
+
+	if !p.isTrusted(r) {
+		return nil, fmt.Errorf("identity header from untrusted address %s", r.RemoteAddr)
+	}
+
+	id := r.Header.Get(p.userHeader)
+	if id == "" {
+		id = value
+	}
+	var groups []string
+	if p.groupsHeader != "" {
+		for _, g := range strings.Split(r.Header.Get(p.groupsHeader), ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				groups = append(groups, g)
+			}
+		}
+	}
+
+	return &User{ID: id, Email: value, Groups: groups, Method: "proxy"}, nil
+}
+
+func (p *proxyAuth) isTrusted(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range p.trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
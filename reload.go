@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// reload fetches the dashboard config and swaps in a router serving it,
+// unless the config is still at version. The current router keeps serving
+// when the config can't be loaded. The version of the fetched config is
+// returned even when it is invalid, so that it isn't reported again until it
+// changes.
+func (s *Server) reload(version string) (string, error) {
+	files, version, err := s.configSource.fetch(version)
+	if err != nil {
+		return version, err
+	}
+
+	dashboards, err := parseDashboards(files, s.config, s.client, s.tmpl)
+	if err != nil {
+		return version, err
+	}
+
+	s.router.Store(s.routes(dashboards))
+	return version, nil
+}
+
+// watchConfig polls the config source for changes and reloads the dashboard
+// config when it changed or on SIGHUP.
+func (s *Server) watchConfig(version string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if s.config.ConfigReloadInterval > 0 {
+		ticker := time.NewTicker(s.config.ConfigReloadInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		current := version
+		select {
+		case <-hup:
+			log.Info().Msg("reloading config on SIGHUP")
+			current = ""
+		case <-tick:
+		}
+
+		newVersion, err := s.reload(current)
+		if newVersion != "" {
+			version = newVersion
+		}
+
+		switch {
+		case err == errNotModified:
+		case err != nil:
+			log.Error().Err(err).Msgf("failed to reload config from %s, keeping the current one", s.configSource)
+		default:
+			log.Info().Msgf("reloaded config from %s", s.configSource)
+		}
+	}
+}
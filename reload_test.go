@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "protodash")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := newTestServer()
+	s.config.ConfigFile = filepath.Join(dir, "config.yml")
+	s.configSource = newConfigSource(s.config.ConfigFile, nil, nil)
+	s.config.DefaultBucket = "protodash"
+	s.client = http.DefaultClient
+
+	matches := func(path string) bool {
+		r := httptest.NewRequest("GET", "http://example.com"+path, nil)
+		return s.router.Load().(*mux.Router).Match(r, &mux.RouteMatch{})
+	}
+
+	assert.NoError(t, ioutil.WriteFile(s.config.ConfigFile, []byte("report:\n  public: true\n"), 0644))
+	_, err = s.reload("")
+	assert.NoError(t, err)
+	assert.True(t, matches("/report/"))
+	assert.False(t, matches("/other/"))
+
+	assert.NoError(t, ioutil.WriteFile(s.config.ConfigFile, []byte("report:\n  public: true\nother:\n  public: true\n"), 0644))
+	_, err = s.reload("")
+	assert.NoError(t, err)
+	assert.True(t, matches("/other/"))
+
+	// the previous router keeps serving when the config is broken
+	assert.NoError(t, ioutil.WriteFile(s.config.ConfigFile, []byte("report: [\n"), 0644))
+	_, err = s.reload("")
+	assert.Error(t, err)
+	assert.True(t, matches("/report/"))
+	assert.True(t, matches("/other/"))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// configSchema returns the JSON Schema of the dashboard config, generated
+// from the yaml and doc tags of Dash so that it follows new fields.
+func configSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"title":       "Protodash dashboard config",
+		"description": "Map of dashboard slugs to their config",
+		"type":        "object",
+		"propertyNames": map[string]interface{}{
+			"pattern": pathSegment.String(),
+		},
+		"additionalProperties": typeSchema(reflect.TypeOf(Dash{})),
+	}
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, ok := yamlFieldName(f)
+			if !ok {
+				continue
+			}
+
+			schema := typeSchema(f.Type)
+			if doc := f.Tag.Get("doc"); doc != "" {
+				schema["description"] = doc
+			}
+			properties[name] = schema
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	}
+	panic(fmt.Sprintf("no JSON Schema for %s", t))
+}
+
+// yamlFieldName returns the key of the field in the config, and false if the
+// field isn't part of the config.
+func yamlFieldName(f reflect.StructField) (string, bool) {
+	name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+	if f.PkgPath != "" || name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = strings.ToLower(f.Name)
+	}
+	return name, true
+}
+
+// schemaCommand implements `protodash schema`, printing the JSON Schema of the
+// dashboard config. It returns the exit code.
+func schemaCommand(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "usage: protodash schema")
+		return 2
+	}
+
+	if err := writeSchema(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func writeSchema(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(configSchema())
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaUpToDate(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, writeSchema(&buf))
+
+	published, err := ioutil.ReadFile("config.schema.json")
+	assert.NoError(t, err)
+	assert.Equal(t, string(published), buf.String(), "run `protodash schema > config.schema.json`")
+}
+
+func TestSchemaFields(t *testing.T) {
+	dash := configSchema()["additionalProperties"].(map[string]interface{})
+	properties := dash["properties"].(map[string]interface{})
+
+	assert.Contains(t, properties, "gcs_bucket")
+	assert.Contains(t, properties, "single_page_app")
+	assert.Contains(t, properties, "subdomain")
+	assert.NotContains(t, properties, "name")
+	assert.NotContains(t, properties, "client")
+	assert.Equal(t, false, dash["additionalProperties"])
+}
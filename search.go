@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// dashboardQuery filters and groups the dashboards listed on the index page
+// and by the API.
+type dashboardQuery struct {
+	// Text is searched in the name, description and owner
+	Text    string
+	Tag     string
+	Team    string
+	GroupBy string
+}
+
+func parseDashboardQuery(r *http.Request) dashboardQuery {
+	q := r.URL.Query()
+	query := dashboardQuery{
+		Text:    strings.TrimSpace(q.Get("q")),
+		Tag:     q.Get("tag"),
+		Team:    q.Get("team"),
+		GroupBy: q.Get("group_by"),
+	}
+	if query.GroupBy != "tag" && query.GroupBy != "team" {
+		query.GroupBy = ""
+	}
+	return query
+}
+
+func (q dashboardQuery) matches(d *Dash) bool {
+	if q.Team != "" && !strings.EqualFold(d.Team, q.Team) {
+		return false
+	}
+	if q.Tag != "" && !hasTag(d, q.Tag) {
+		return false
+	}
+	if q.Text == "" {
+		return true
+	}
+
+	text := strings.ToLower(q.Text)
+	for _, field := range []string{d.Name, d.Slug, d.Description, d.Owner} {
+		if strings.Contains(strings.ToLower(field), text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q dashboardQuery) filter(dashboards []*Dash) []*Dash {
+	var matching []*Dash
+	for _, d := range dashboards {
+		if q.matches(d) {
+			matching = append(matching, d)
+		}
+	}
+	return matching
+}
+
+func hasTag(d *Dash, tag string) bool {
+	for _, t := range d.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// dashboardGroup is a heading of the index page and its dashboards.
+type dashboardGroup struct {
+	Name       string
+	Dashboards []*Dash
+}
+
+// groupDashboards groups the dashboards by team or tag, keeping their order
+// within groups. Groups are sorted by name, with dashboards without a team or
+// tag last. Without groupBy, a single unnamed group is returned.
+func groupDashboards(dashboards []*Dash, groupBy string) []*dashboardGroup {
+	if groupBy == "" {
+		return []*dashboardGroup{{Dashboards: dashboards}}
+	}
+
+	groups := make(map[string]*dashboardGroup)
+	var other []*Dash
+	add := func(name string, d *Dash) {
+		if groups[name] == nil {
+			groups[name] = &dashboardGroup{Name: name}
+		}
+		groups[name].Dashboards = append(groups[name].Dashboards, d)
+	}
+
+	for _, d := range dashboards {
+		switch {
+		case groupBy == "team" && d.Team != "":
+			add(d.Team, d)
+		case groupBy == "tag" && len(d.Tags) > 0:
+			for _, tag := range d.Tags {
+				add(tag, d)
+			}
+		default:
+			other = append(other, d)
+		}
+	}
+
+	sorted := make([]*dashboardGroup, 0, len(groups)+1)
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return strings.ToLower(sorted[i].Name) < strings.ToLower(sorted[j].Name)
+	})
+	if len(other) > 0 {
+		sorted = append(sorted, &dashboardGroup{Name: "Other", Dashboards: other})
+	}
+	return sorted
+}
+
+// sortDashboards sorts the dashboards by name, then slug.
+func sortDashboards(dashboards []*Dash) {
+	sort.SliceStable(dashboards, func(i, j int) bool {
+		a, b := strings.ToLower(dashboards[i].Name), strings.ToLower(dashboards[j].Name)
+		if a != b {
+			return a < b
+		}
+		return dashboards[i].Slug < dashboards[j].Slug
+	})
+}
+
+// dashboardFacets returns the sorted tags and teams of the dashboards.
+func dashboardFacets(dashboards []*Dash) (tags, teams []string) {
+	seenTags := make(map[string]bool)
+	seenTeams := make(map[string]bool)
+	for _, d := range dashboards {
+		for _, tag := range d.Tags {
+			if !seenTags[tag] {
+				seenTags[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+		if d.Team != "" && !seenTeams[d.Team] {
+			seenTeams[d.Team] = true
+			teams = append(teams, d.Team)
+		}
+	}
+	sort.Strings(tags)
+	sort.Strings(teams)
+	return tags, teams
+}
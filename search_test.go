@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func slugs(dashboards []*Dash) []string {
+	var s []string
+	for _, d := range dashboards {
+		s = append(s, d.Slug)
+	}
+	return s
+}
+
+func TestDashboardQuery(t *testing.T) {
+	dashboards := []*Dash{
+		{Name: "Crash Rates", Slug: "crashes", Team: "Stability", Tags: []string{"weekly"}},
+		{Name: "Revenue", Slug: "revenue", Owner: "Jane Doe", Tags: []string{"Finance", "weekly"}},
+		{Name: "Search", Slug: "search", Description: "Search engine crash reports", Team: "search"},
+	}
+
+	query := func(rawQuery string) []string {
+		r := httptest.NewRequest("GET", "/?"+rawQuery, nil)
+		return slugs(parseDashboardQuery(r).filter(dashboards))
+	}
+
+	assert.Equal(t, []string{"crashes", "revenue", "search"}, query(""))
+	assert.Equal(t, []string{"crashes", "search"}, query("q=CRASH"))
+	assert.Equal(t, []string{"revenue"}, query("q=jane"))
+	assert.Equal(t, []string{"crashes", "revenue"}, query("tag=weekly"))
+	assert.Equal(t, []string{"revenue"}, query("tag=finance&q=rev"))
+	assert.Equal(t, []string{"search"}, query("team=Search"))
+	assert.Empty(t, query("q=nothing"))
+}
+
+func TestGroupDashboards(t *testing.T) {
+	dashboards := []*Dash{
+		{Slug: "a", Team: "b-team", Tags: []string{"x", "y"}},
+		{Slug: "b", Tags: []string{"y"}},
+		{Slug: "c", Team: "a-team"},
+	}
+
+	groups := groupDashboards(dashboards, "")
+	assert.Len(t, groups, 1)
+	assert.Equal(t, "", groups[0].Name)
+	assert.Equal(t, []string{"a", "b", "c"}, slugs(groups[0].Dashboards))
+
+	groups = groupDashboards(dashboards, "team")
+	assert.Len(t, groups, 3)
+	assert.Equal(t, "a-team", groups[0].Name)
+	assert.Equal(t, "b-team", groups[1].Name)
+	assert.Equal(t, "Other", groups[2].Name)
+	assert.Equal(t, []string{"b"}, slugs(groups[2].Dashboards))
+
+	groups = groupDashboards(dashboards, "tag")
+	assert.Len(t, groups, 3)
+	assert.Equal(t, []string{"a"}, slugs(groups[0].Dashboards))
+	assert.Equal(t, "y", groups[1].Name)
+	assert.Equal(t, []string{"a", "b"}, slugs(groups[1].Dashboards))
+	assert.Equal(t, []string{"c"}, slugs(groups[2].Dashboards))
+}
+
+func TestSortDashboards(t *testing.T) {
+	dashboards := []*Dash{
+		{Name: "beta", Slug: "beta"},
+		{Name: "Alpha", Slug: "z"},
+		{Name: "alpha", Slug: "a"},
+	}
+	sortDashboards(dashboards)
+	assert.Equal(t, []string{"a", "z", "beta"}, slugs(dashboards))
+}
@@ -1,8 +1,67 @@
 package main
 
-import "github.com/gorilla/sessions"
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/gorilla/sessions"
+	"github.com/mozilla/protodash/audit"
+	"github.com/mozilla/protodash/jwt"
+)
 
 type Server struct {
-	config       *Config
-	sessionStore sessions.Store
+	config         *Config
+	sessionStore   sessions.Store
+	bearerVerifier *jwt.Verifier
+	logoutVerifier *jwt.Verifier
+	proxyAuth      *proxyAuth
+	audit          audit.Sink
+	tmpl           *template.Template
+	client         *http.Client
+	configSource   configSource
+	maintenance    maintenanceModes
+	updated        updatedCache
+	handoffs       usedNonces
+	impersonations usedNonces
+
+	// router holds the *mux.Router serving the current dashboard config, it
+	// is replaced when the config is reloaded.
+	router atomic.Value
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.Load().(http.Handler).ServeHTTP(w, r)
+}
+
+// listenAndServe serves until SIGINT or SIGTERM, then lets the requests in
+// flight finish within ProxyTimeout and closes the audit log, so that the
+// events still queued for delivery aren't lost.
+func (s *Server) listenAndServe() error {
+	srv := &http.Server{Addr: s.config.Listen, Handler: s}
+
+	shutdown := make(chan error, 1)
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+		<-stop
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.config.ProxyTimeout)
+		defer cancel()
+		shutdown <- srv.Shutdown(ctx)
+	}()
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+
+	err := <-shutdown
+	if cerr := s.audit.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/mozilla/protodash/sessionstore"
+)
+
+// sessionRevoker is implemented by session stores that keep sessions
+// server-side and can therefore revoke them.
+type sessionRevoker interface {
+	RevokeUser(user string) (int, error)
+}
+
+// sessionRenewer is implemented by session stores that keep sessions
+// server-side, whose IDs must be renewed when the session is authenticated.
+type sessionRenewer interface {
+	Renew(session *sessions.Session) error
+}
+
+// renewSession empties the session before a user is logged into it, moving it
+// to a new ID with server-side stores. Otherwise an ID planted in the browser
+// beforehand, for example by a dashboard subdomain setting a cookie on the
+// base domain, would end up authenticated.
+func (s *Server) renewSession(session *sessions.Session) error {
+	if renewer, ok := s.sessionStore.(sessionRenewer); ok {
+		if err := renewer.Renew(session); err != nil {
+			return err
+		}
+	}
+	session.Values = make(map[interface{}]interface{})
+	return nil
+}
+
+// newSessionStore builds the session store selected by the SessionStore
+// config option.
+func newSessionStore(cfg *Config) (sessions.Store, error) {
+	parts := strings.Split(cfg.BaseDomain, ":")
+	secret := []byte(cfg.SessionSecret)
+
+	var backend sessionstore.Backend
+	switch cfg.SessionStore {
+	case "cookie":
+		cookieStore := sessions.NewCookieStore(secret)
+		cookieStore.Options.HttpOnly = true
+		cookieStore.Options.SameSite = http.SameSiteLaxMode
+		cookieStore.Options.Domain = parts[0]
+		return cookieStore, nil
+	case "memory":
+		backend = sessionstore.NewMemoryBackend()
+	case "bolt":
+		b, err := sessionstore.NewBoltBackend(cfg.SessionStorePath)
+		if err != nil {
+			return nil, err
+		}
+		backend = b
+	case "redis":
+		backend = sessionstore.NewRedisBackend(cfg.SessionRedisURL)
+	default:
+		return nil, fmt.Errorf("unknown session store %q", cfg.SessionStore)
+	}
+
+	store := sessionstore.New(backend, secret)
+	store.Options.HttpOnly = true
+	store.Options.SameSite = http.SameSiteLaxMode
+	store.Options.Domain = parts[0]
+	store.UserKey = "current_user_id"
+	return store, nil
+}
@@ -0,0 +1,146 @@
+package sessionstore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mozilla/protodash/sessionstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func testBackend(t *testing.T, b sessionstore.Backend) {
+	_, err := b.Load("missing")
+	assert.Equal(t, sessionstore.ErrNotFound, err)
+
+	assert.NoError(t, b.Save("s1", "alice", []byte("one"), time.Hour))
+	assert.NoError(t, b.Save("s2", "alice", []byte("two"), time.Hour))
+	assert.NoError(t, b.Save("s3", "bob", []byte("three"), 0))
+	assert.NoError(t, b.Save("s4", "", []byte("anonymous"), time.Hour))
+
+	data, err := b.Load("s1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("one"), data)
+
+	assert.NoError(t, b.Delete("s2"))
+	_, err = b.Load("s2")
+	assert.Equal(t, sessionstore.ErrNotFound, err)
+
+	n, err := b.DeleteUser("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = b.Load("s1")
+	assert.Equal(t, sessionstore.ErrNotFound, err)
+
+	data, err = b.Load("s3")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("three"), data)
+
+	data, err = b.Load("s4")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("anonymous"), data)
+
+	n, err = b.DeleteUser("nobody")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestMemoryBackend(t *testing.T) {
+	testBackend(t, sessionstore.NewMemoryBackend())
+}
+
+func TestMemoryBackendExpiry(t *testing.T) {
+	b := sessionstore.NewMemoryBackend()
+	assert.NoError(t, b.Save("s1", "alice", []byte("one"), time.Nanosecond))
+	time.Sleep(time.Millisecond)
+
+	_, err := b.Load("s1")
+	assert.Equal(t, sessionstore.ErrNotFound, err)
+}
+
+func TestBoltBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessionstore")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b, err := sessionstore.NewBoltBackend(filepath.Join(dir, "sessions.db"))
+	assert.NoError(t, err)
+	defer b.Close()
+
+	testBackend(t, b)
+}
+
+func TestBoltBackendExpiry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessionstore")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b, err := sessionstore.NewBoltBackend(filepath.Join(dir, "sessions.db"))
+	assert.NoError(t, err)
+	defer b.Close()
+
+	assert.NoError(t, b.Save("s1", "alice", []byte("one"), time.Nanosecond))
+	assert.NoError(t, b.Save("s2", "alice", []byte("two"), time.Nanosecond))
+	assert.NoError(t, b.Save("s3", "alice", []byte("three"), time.Hour))
+	time.Sleep(time.Millisecond)
+
+	// loading an expired session deletes it
+	_, err = b.Load("s1")
+	assert.Equal(t, sessionstore.ErrNotFound, err)
+
+	n, err := b.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// only the live session is left in the user index
+	n, err = b.DeleteUser("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = b.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestRedisBackend(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	b := sessionstore.NewRedisBackend("redis://" + mr.Addr())
+	defer b.Close()
+
+	testBackend(t, b)
+
+	assert.False(t, mr.Exists("protodash:session:s1"))
+	assert.False(t, mr.Exists("protodash:session-user:s1"))
+	assert.Equal(t, time.Hour, mr.TTL("protodash:session:s4"))
+}
+
+func TestRedisBackendDeleteUpdatesUserSet(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	b := sessionstore.NewRedisBackend("redis://" + mr.Addr())
+	defer b.Close()
+
+	assert.NoError(t, b.Save("s1", "alice", []byte("one"), time.Hour))
+	assert.NoError(t, b.Save("s2", "alice", []byte("two"), time.Hour))
+	assert.Equal(t, time.Hour, mr.TTL("protodash:session-user:s1"))
+
+	assert.NoError(t, b.Delete("s1"))
+	members, err := mr.Members("protodash:user:alice")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"s2"}, members)
+	assert.False(t, mr.Exists("protodash:session-user:s1"))
+
+	// a session saved for another user leaves the set of the previous one
+	assert.NoError(t, b.Save("s2", "bob", []byte("two"), time.Hour))
+	assert.False(t, mr.Exists("protodash:user:alice"))
+	members, _ = mr.Members("protodash:user:bob")
+	assert.Equal(t, []string{"s2"}, members)
+}
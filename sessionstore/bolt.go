@@ -0,0 +1,220 @@
+package sessionstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltSessionsBucket = []byte("sessions")
+	boltUsersBucket    = []byte("users")
+)
+
+// boltSweepInterval is how often expired sessions are removed from the
+// database.
+const boltSweepInterval = 10 * time.Minute
+
+type boltRecord struct {
+	User    string    `json:"user"`
+	Data    []byte    `json:"data"`
+	Expires time.Time `json:"expires"`
+}
+
+func (r *boltRecord) expired(now time.Time) bool {
+	return !r.Expires.IsZero() && now.After(r.Expires)
+}
+
+// BoltBackend keeps sessions in a bbolt database file, so sessions survive a
+// restart of a single instance. Expired sessions are removed when loaded and
+// periodically swept.
+type BoltBackend struct {
+	db   *bolt.DB
+	done chan struct{}
+}
+
+// NewBoltBackend opens (creating if needed) the bbolt database at path.
+func NewBoltBackend(path string) (*BoltBackend, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(boltSessionsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(boltUsersBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	b := &BoltBackend{db: db, done: make(chan struct{})}
+	go b.sweep(boltSweepInterval)
+	return b, nil
+}
+
+// Close stops the sweeps and closes the underlying database.
+func (b *BoltBackend) Close() error {
+	close(b.done)
+	return b.db.Close()
+}
+
+func (b *BoltBackend) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			b.Prune()
+		}
+	}
+}
+
+// Prune removes every expired session and returns how many there were.
+func (b *BoltBackend) Prune() (int, error) {
+	now := time.Now()
+	var expired [][]byte
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(boltSessionsBucket).ForEach(func(k, v []byte) error {
+			var rec boltRecord
+			if err := json.Unmarshal(v, &rec); err == nil && rec.expired(now) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range expired {
+			if err := b.delete(tx, string(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(expired), nil
+}
+
+func (b *BoltBackend) Load(id string) ([]byte, error) {
+	var rec boltRecord
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltSessionsBucket).Get([]byte(id))
+		if v == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(v, &rec)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if rec.expired(now) {
+		err = b.db.Update(func(tx *bolt.Tx) error {
+			// the session may have been saved again in the meantime
+			v := tx.Bucket(boltSessionsBucket).Get([]byte(id))
+			var current boltRecord
+			if v == nil || json.Unmarshal(v, &current) != nil || !current.expired(now) {
+				return nil
+			}
+			return b.delete(tx, id)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	}
+	return rec.Data, nil
+}
+
+func (b *BoltBackend) Save(id, user string, data []byte, ttl time.Duration) error {
+	rec := boltRecord{User: user, Data: data}
+	if ttl > 0 {
+		rec.Expires = time.Now().Add(ttl)
+	}
+	v, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := b.delete(tx, id); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltSessionsBucket).Put([]byte(id), v); err != nil {
+			return err
+		}
+		if user == "" {
+			return nil
+		}
+		return tx.Bucket(boltUsersBucket).Put(userIndexKey(user, id), nil)
+	})
+}
+
+func (b *BoltBackend) Delete(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return b.delete(tx, id)
+	})
+}
+
+func (b *BoltBackend) DeleteUser(user string) (int, error) {
+	n := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		sessions := tx.Bucket(boltSessionsBucket)
+		users := tx.Bucket(boltUsersBucket)
+
+		prefix := userIndexKey(user, "")
+		var keys [][]byte
+		c := users.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+
+		for _, k := range keys {
+			id := k[len(prefix):]
+			if sessions.Get(id) != nil {
+				n++
+				if err := sessions.Delete(id); err != nil {
+					return err
+				}
+			}
+			if err := users.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// delete removes a session and its user index entry within tx.
+func (b *BoltBackend) delete(tx *bolt.Tx, id string) error {
+	sessions := tx.Bucket(boltSessionsBucket)
+	v := sessions.Get([]byte(id))
+	if v == nil {
+		return nil
+	}
+
+	var rec boltRecord
+	if err := json.Unmarshal(v, &rec); err == nil && rec.User != "" {
+		if err := tx.Bucket(boltUsersBucket).Delete(userIndexKey(rec.User, id)); err != nil {
+			return err
+		}
+	}
+	return sessions.Delete([]byte(id))
+}
+
+func userIndexKey(user, id string) []byte {
+	return []byte(user + "\x00" + id)
+}
@@ -0,0 +1,120 @@
+package sessionstore
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryRecord struct {
+	user    string
+	data    []byte
+	expires time.Time
+}
+
+func (r *memoryRecord) expired(now time.Time) bool {
+	return !r.expires.IsZero() && now.After(r.expires)
+}
+
+// MemoryBackend keeps sessions in process memory. Sessions are lost on
+// restart and are not shared between replicas.
+type MemoryBackend struct {
+	mu       sync.Mutex
+	sessions map[string]*memoryRecord
+	users    map[string]map[string]struct{}
+}
+
+// NewMemoryBackend returns an empty MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		sessions: make(map[string]*memoryRecord),
+		users:    make(map[string]map[string]struct{}),
+	}
+}
+
+func (b *MemoryBackend) Load(id string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	rec, ok := b.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if rec.expired(time.Now()) {
+		b.delete(id)
+		return nil, ErrNotFound
+	}
+	return rec.data, nil
+}
+
+func (b *MemoryBackend) Save(id, user string, data []byte, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.prune()
+
+	if rec, ok := b.sessions[id]; ok && rec.user != user {
+		b.delete(id)
+	}
+
+	rec := &memoryRecord{user: user, data: data}
+	if ttl > 0 {
+		rec.expires = time.Now().Add(ttl)
+	}
+	b.sessions[id] = rec
+
+	if user != "" {
+		if _, ok := b.users[user]; !ok {
+			b.users[user] = make(map[string]struct{})
+		}
+		b.users[user][id] = struct{}{}
+	}
+
+	return nil
+}
+
+func (b *MemoryBackend) Delete(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.delete(id)
+	return nil
+}
+
+func (b *MemoryBackend) DeleteUser(user string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := 0
+	for id := range b.users[user] {
+		if _, ok := b.sessions[id]; ok {
+			n++
+		}
+		b.delete(id)
+	}
+	return n, nil
+}
+
+// delete removes a session and its user index entry, the lock must be held.
+func (b *MemoryBackend) delete(id string) {
+	rec, ok := b.sessions[id]
+	if !ok {
+		return
+	}
+	delete(b.sessions, id)
+	if ids, ok := b.users[rec.user]; ok {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(b.users, rec.user)
+		}
+	}
+}
+
+// prune removes all expired sessions, the lock must be held.
+func (b *MemoryBackend) prune() {
+	now := time.Now()
+	for id, rec := range b.sessions {
+		if rec.expired(now) {
+			b.delete(id)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package sessionstore
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	redisSessionPrefix     = "protodash:session:"
+	redisSessionUserPrefix = "protodash:session-user:"
+	redisUserPrefix        = "protodash:user:"
+)
+
+// RedisBackend keeps sessions in any server speaking the Redis protocol, so
+// sessions can be shared between replicas.
+type RedisBackend struct {
+	pool *redis.Pool
+}
+
+// NewRedisBackend returns a RedisBackend connecting to the server at rawurl,
+// e.g. redis://:password@localhost:6379/0.
+func NewRedisBackend(rawurl string) *RedisBackend {
+	return &RedisBackend{
+		pool: &redis.Pool{
+			MaxIdle:     10,
+			IdleTimeout: 240 * time.Second,
+			Dial: func() (redis.Conn, error) {
+				return redis.DialURL(rawurl)
+			},
+		},
+	}
+}
+
+// Close releases the connections held by the pool.
+func (b *RedisBackend) Close() error {
+	return b.pool.Close()
+}
+
+func (b *RedisBackend) Load(id string) ([]byte, error) {
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	data, err := redis.Bytes(conn.Do("GET", redisSessionPrefix+id))
+	if err == redis.ErrNil {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (b *RedisBackend) Save(id, user string, data []byte, ttl time.Duration) error {
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	// the session may change hands, e.g. when logging in again
+	previous, err := redis.String(conn.Do("GET", redisSessionUserPrefix+id))
+	if err != nil && err != redis.ErrNil {
+		return err
+	}
+	if previous != "" && previous != user {
+		if _, err = conn.Do("SREM", redisUserPrefix+previous, id); err != nil {
+			return err
+		}
+	}
+
+	set := func(key string, value interface{}) error {
+		args := redis.Args{key, value}
+		if ttl > 0 {
+			args = args.Add("EX", int64(ttl/time.Second))
+		}
+		_, err := conn.Do("SET", args...)
+		return err
+	}
+	if err = set(redisSessionPrefix+id, data); err != nil {
+		return err
+	}
+
+	if user == "" {
+		_, err = conn.Do("DEL", redisSessionUserPrefix+id)
+		return err
+	}
+
+	// remember the user of the session to remove it from their set on delete
+	if err = set(redisSessionUserPrefix+id, user); err != nil {
+		return err
+	}
+
+	key := redisUserPrefix + user
+	if _, err := conn.Do("SADD", key, id); err != nil {
+		return err
+	}
+	if ttl > 0 {
+		// keep the index around as long as its newest session
+		if _, err := conn.Do("EXPIRE", key, int64(ttl/time.Second)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *RedisBackend) Delete(id string) error {
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	user, err := redis.String(conn.Do("GET", redisSessionUserPrefix+id))
+	if err != nil && err != redis.ErrNil {
+		return err
+	}
+	if user != "" {
+		if _, err = conn.Do("SREM", redisUserPrefix+user, id); err != nil {
+			return err
+		}
+	}
+
+	_, err = conn.Do("DEL", redisSessionPrefix+id, redisSessionUserPrefix+id)
+	return err
+}
+
+func (b *RedisBackend) DeleteUser(user string) (int, error) {
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	key := redisUserPrefix + user
+	ids, err := redis.Strings(conn.Do("SMEMBERS", key))
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, id := range ids {
+		deleted, err := redis.Int(conn.Do("DEL", redisSessionPrefix+id))
+		if err != nil {
+			return n, err
+		}
+		if _, err = conn.Do("DEL", redisSessionUserPrefix+id); err != nil {
+			return n, err
+		}
+		n += deleted
+	}
+
+	_, err = conn.Do("DEL", key)
+	return n, err
+}
@@ -0,0 +1,173 @@
+package sessionstore
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// ErrNotFound is returned by a Backend when a session does not exist or has
+// expired.
+var ErrNotFound = errors.New("session not found")
+
+// Backend persists encoded session values keyed by session ID. Sessions are
+// also indexed by user so that every session belonging to a user can be
+// revoked at once.
+type Backend interface {
+	// Load returns the data stored for the session or ErrNotFound.
+	Load(id string) ([]byte, error)
+	// Save stores the data for the session, indexing it under user if user is
+	// not empty. A ttl of zero means the session does not expire.
+	Save(id, user string, data []byte, ttl time.Duration) error
+	// Delete removes a single session.
+	Delete(id string) error
+	// DeleteUser removes every session indexed under user and returns the
+	// number of sessions removed.
+	DeleteUser(user string) (int, error)
+}
+
+// Store is a sessions.Store that keeps session values in a Backend and only
+// stores the signed session ID in the cookie.
+type Store struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+	// UserKey is the session value used to index the session by user.
+	UserKey interface{}
+
+	backend Backend
+}
+
+// New returns a Store persisting sessions in backend. The keyPairs are used
+// to sign (and optionally encrypt) the session ID cookie, see
+// securecookie.CodecsFromPairs.
+func New(backend Backend, keyPairs ...[]byte) *Store {
+	s := &Store{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   86400 * 30,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+		backend: backend,
+	}
+	s.MaxAge(s.Options.MaxAge)
+	return s
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+// A cookie referencing a session that no longer exists in the backend (because
+// it expired or was revoked) results in a new, empty session.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	if err = securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...); err != nil {
+		return session, err
+	}
+
+	data, err := s.backend.Load(session.ID)
+	if err == ErrNotFound {
+		session.ID = ""
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+
+	if err = gob.NewDecoder(bytes.NewReader(data)).Decode(&session.Values); err != nil {
+		return session, err
+	}
+	session.IsNew = false
+
+	return session, nil
+}
+
+// Save persists the session in the backend and writes the session ID cookie.
+// Sessions with a negative MaxAge are deleted from the backend.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.backend.Delete(session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = strings.TrimRight(
+			base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)),
+			"=",
+		)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(session.Values); err != nil {
+		return err
+	}
+
+	user, _ := session.Values[s.UserKey].(string)
+	ttl := time.Duration(session.Options.MaxAge) * time.Second
+	if err := s.backend.Save(session.ID, user, buf.Bytes(), ttl); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// MaxAge sets the maximum age for the store and the underlying cookie
+// implementation.
+func (s *Store) MaxAge(age int) {
+	s.Options.MaxAge = age
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(age)
+		}
+	}
+}
+
+// RevokeUser deletes every session belonging to user and returns the number
+// of sessions removed.
+func (s *Store) RevokeUser(user string) (int, error) {
+	return s.backend.DeleteUser(user)
+}
+
+// Renew deletes the session from the backend and clears its ID, so that the
+// next Save stores it under a new ID. Call it before authenticating a session
+// so that an ID known to someone else is not promoted along with it.
+func (s *Store) Renew(session *sessions.Session) error {
+	if session.ID != "" {
+		if err := s.backend.Delete(session.ID); err != nil {
+			return err
+		}
+		session.ID = ""
+	}
+	session.IsNew = true
+	return nil
+}
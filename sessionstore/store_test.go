@@ -0,0 +1,109 @@
+package sessionstore_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mozilla/protodash/sessionstore"
+	"github.com/stretchr/testify/assert"
+)
+
+const sessionName = "test_session"
+
+func newStore() *sessionstore.Store {
+	s := sessionstore.New(sessionstore.NewMemoryBackend(), []byte("secret"))
+	s.UserKey = "user"
+	return s
+}
+
+func saveSession(t *testing.T, s *sessionstore.Store, user string) *http.Cookie {
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	session, err := s.New(r, sessionName)
+	assert.NoError(t, err)
+	session.Values["user"] = user
+	assert.NoError(t, session.Save(r, w))
+
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	return cookies[0]
+}
+
+func loadSession(t *testing.T, s *sessionstore.Store, c *http.Cookie) map[interface{}]interface{} {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(c)
+
+	session, err := s.New(r, sessionName)
+	assert.NoError(t, err)
+	return session.Values
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	s := newStore()
+	c := saveSession(t, s, "alice")
+
+	assert.NotContains(t, c.Value, "alice")
+	assert.Equal(t, "alice", loadSession(t, s, c)["user"])
+}
+
+func TestStoreRevokeUser(t *testing.T) {
+	s := newStore()
+	alice1 := saveSession(t, s, "alice")
+	alice2 := saveSession(t, s, "alice")
+	bob := saveSession(t, s, "bob")
+
+	n, err := s.RevokeUser("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	assert.Empty(t, loadSession(t, s, alice1))
+	assert.Empty(t, loadSession(t, s, alice2))
+	assert.Equal(t, "bob", loadSession(t, s, bob)["user"])
+}
+
+func TestStoreDeleteSession(t *testing.T) {
+	s := newStore()
+	c := saveSession(t, s, "alice")
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(c)
+	w := httptest.NewRecorder()
+
+	session, _ := s.New(r, sessionName)
+	session.Options.MaxAge = -1
+	assert.NoError(t, session.Save(r, w))
+
+	assert.Empty(t, loadSession(t, s, c))
+}
+
+func TestStoreTamperedCookie(t *testing.T) {
+	s := newStore()
+	c := saveSession(t, s, "alice")
+	c.Value = "x" + c.Value
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(c)
+
+	_, err := s.New(r, sessionName)
+	assert.Error(t, err)
+}
+
+func TestStoreRenew(t *testing.T) {
+	s := newStore()
+	c := saveSession(t, s, "alice")
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(c)
+	w := httptest.NewRecorder()
+
+	session, _ := s.New(r, sessionName)
+	id := session.ID
+	assert.NoError(t, s.Renew(session))
+	assert.NoError(t, session.Save(r, w))
+
+	assert.NotEqual(t, id, session.ID)
+	assert.Empty(t, loadSession(t, s, c))
+	assert.Equal(t, "alice", loadSession(t, s, w.Result().Cookies()[0])["user"])
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	shareParam        = "share"
+	shareCookiePrefix = "_protodash_share_"
+	defaultShareTTL   = 7 * 24 * time.Hour
+)
+
+var (
+	errInvalidShareToken = errors.New("invalid share token")
+	errExpiredShareToken = errors.New("share token is expired")
+)
+
+// shareClaims are the contents of a share token, granting read access to a
+// dashboard (optionally limited to a path prefix) until it expires.
+type shareClaims struct {
+	Dashboard string `json:"d"`
+	Prefix    string `json:"p,omitempty"`
+	Expires   int64  `json:"e"`
+	User      string `json:"u"`
+}
+
+// shareKey returns the key used to sign share tokens, share links are
+// disabled when it is empty. Without a share secret, the key is derived from
+// the session secret so that it isn't used for both.
+func (s *Server) shareKey() []byte {
+	if s.config.ShareSecret != "" {
+		return []byte(s.config.ShareSecret)
+	}
+	if s.config.SessionSecret == "" {
+		return nil
+	}
+	key := sha256.Sum256([]byte("protodash share\x00" + s.config.SessionSecret))
+	return key[:]
+}
+
+// sharePrefixMatches returns whether the path is within the prefix a share
+// link is limited to, which is a directory or a single file.
+func sharePrefixMatches(path, prefix string) bool {
+	return prefix == "" ||
+		path == prefix ||
+		strings.HasSuffix(prefix, "/") && strings.HasPrefix(path, prefix) ||
+		strings.HasPrefix(path, prefix+"/")
+}
+
+func (s *Server) signShareToken(c *shareClaims) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	mac := hmac.New(sha256.New, s.shareKey())
+	mac.Write([]byte(encoded))
+	sig := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	return encoded + "." + sig, nil
+}
+
+func (s *Server) verifyShareToken(token string) (*shareClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, errInvalidShareToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errInvalidShareToken
+	}
+
+	mac := hmac.New(sha256.New, s.shareKey())
+	mac.Write([]byte(parts[0]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errInvalidShareToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errInvalidShareToken
+	}
+
+	c := &shareClaims{}
+	if err = json.Unmarshal(payload, c); err != nil {
+		return nil, errInvalidShareToken
+	}
+
+	if time.Now().After(time.Unix(c.Expires, 0)) {
+		return nil, errExpiredShareToken
+	}
+
+	return c, nil
+}
+
+// acceptShareLinks lets requests carrying a valid share token for the
+// dashboard through as the user that created the link. A token passed in the
+// query string is moved to a cookie so that the assets of the dashboard load
+// too, and the request is redirected to drop it from the URL.
+func (s *Server) acceptShareLinks(d *Dash) func(http.Handler) http.Handler {
+	cookieName := shareCookiePrefix + d.Slug
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(s.shareKey()) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token := r.URL.Query().Get(shareParam)
+			fromQuery := token != ""
+			if !fromQuery {
+				if c, err := r.Cookie(cookieName); err == nil {
+					token = c.Value
+				}
+			}
+			if token == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			c, err := s.verifyShareToken(token)
+			if err == nil && (c.Dashboard != d.Slug || !sharePrefixMatches(d.relPath(r), c.Prefix)) {
+				err = errInvalidShareToken
+			}
+			if err != nil {
+				hlog.FromRequest(r).Warn().Err(err).Str("dashboard", d.Slug).Msg("rejected share token")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if fromQuery {
+				http.SetCookie(w, &http.Cookie{
+					Name:     cookieName,
+					Value:    token,
+					Path:     "/",
+					Expires:  time.Unix(c.Expires, 0),
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+
+				u := cloneURL(r.URL)
+				q := u.Query()
+				q.Del(shareParam)
+				u.RawQuery = q.Encode()
+				http.Redirect(w, r, u.String(), http.StatusFound)
+				return
+			}
+
+			user := &User{ID: "share:" + c.User, Method: "share"}
+			next.ServeHTTP(w, setUser(r, user))
+		})
+	}
+}
+
+type shareResponse struct {
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// shareCreate mints a share link for the dashboard, path prefix and ttl given
+// in the request. Only bearer tokens are accepted: the pages of dashboards are
+// served from the same origin, so they could mint links with the cookies of
+// their viewers otherwise.
+func (s *Server) shareCreate(dashboards []*Dash) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+		if user.Method != "bearer" && user.Method != "token" {
+			http.Error(w, "Share Links Require A Bearer Token", http.StatusForbidden)
+			return
+		}
+
+		var d *Dash
+		for _, dashboard := range dashboards {
+			if dashboard.Slug == r.FormValue("dashboard") {
+				d = dashboard
+			}
+		}
+		if d == nil {
+			http.Error(w, "Unknown Dashboard", http.StatusBadRequest)
+			return
+		}
+		if user.Impersonator != nil || !s.canAccess(d, user) {
+			http.Error(w, "403 Forbidden", http.StatusForbidden)
+			return
+		}
+
+		ttl := defaultShareTTL
+		if v := r.FormValue("ttl"); v != "" {
+			var err error
+			if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 {
+				http.Error(w, "Invalid TTL", http.StatusBadRequest)
+				return
+			}
+		}
+		if ttl > s.config.ShareMaxTTL {
+			http.Error(w, fmt.Sprintf("TTL Exceeds Maximum Of %s", s.config.ShareMaxTTL), http.StatusBadRequest)
+			return
+		}
+
+		c := &shareClaims{
+			Dashboard: d.Slug,
+			Prefix:    strings.TrimPrefix(r.FormValue("path"), "/"),
+			Expires:   time.Now().Add(ttl).Unix(),
+			User:      user.ID,
+		}
+		token, err := s.signShareToken(c)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		u := &url.URL{
+			Scheme:   requestScheme(r),
+			Host:     s.config.BaseDomain,
+			Path:     "/" + d.Slug + "/" + c.Prefix,
+			RawQuery: url.Values{shareParam: {token}}.Encode(),
+		}
+		if d.Subdomain {
+			u.Host = d.Slug + "." + s.config.BaseDomain
+			u.Path = "/" + c.Prefix
+		}
+
+		hlog.FromRequest(r).Info().
+			Str("user", user.ID).
+			Str("dashboard", d.Slug).
+			Str("prefix", c.Prefix).
+			Dur("ttl", ttl).
+			Msg("created share link")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&shareResponse{
+			URL:     u.String(),
+			Expires: time.Unix(c.Expires, 0).UTC(),
+		})
+	}
+}
+
+// requestScheme returns the scheme the client used to reach protodash,
+// honouring the header set by load balancers.
+func requestScheme(r *http.Request) string {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return proto
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShareToken(t *testing.T) {
+	s := newTestServer()
+	s.config.ShareSecret = "share-secret"
+
+	token, err := s.signShareToken(&shareClaims{
+		Dashboard: "report",
+		Expires:   time.Now().Add(time.Hour).Unix(),
+		User:      "user-1",
+	})
+	assert.NoError(t, err)
+
+	c, err := s.verifyShareToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "report", c.Dashboard)
+
+	_, err = s.verifyShareToken("x" + token)
+	assert.Equal(t, errInvalidShareToken, err)
+
+	s.config.ShareSecret = "rotated"
+	_, err = s.verifyShareToken(token)
+	assert.Equal(t, errInvalidShareToken, err)
+
+	token, _ = s.signShareToken(&shareClaims{
+		Dashboard: "report",
+		Expires:   time.Now().Add(-time.Hour).Unix(),
+	})
+	_, err = s.verifyShareToken(token)
+	assert.Equal(t, errExpiredShareToken, err)
+}
+
+func TestShareLinkFlow(t *testing.T) {
+	s := newTestServer()
+	s.config.ShareSecret = "share-secret"
+	s.config.ShareMaxTTL = 720 * time.Hour
+
+	d := &Dash{Slug: "report", Config: s.config}
+
+	// mint a link as a machine client
+	r := httptest.NewRequest("POST", "/share", strings.NewReader("dashboard=report&path=2021/&ttl=24h"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r = r.WithContext(withUser(r.Context(), &User{ID: "user-1", Method: "bearer"}))
+	w := httptest.NewRecorder()
+	s.shareCreate([]*Dash{d}).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp shareResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	u, _ := url.Parse(resp.URL)
+	assert.Equal(t, "/report/2021/", u.Path)
+
+	h := s.acceptShareLinks(d)(s.requireAuth(echoUser()))
+
+	// the token in the query is moved to a cookie
+	r = httptest.NewRequest("GET", u.RequestURI(), nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/report/2021/", w.Header().Get("Location"))
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+
+	// the cookie grants access under the prefix only
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/report/2021/", http.StatusOK},
+		{"/report/2021/style.css", http.StatusOK},
+		{"/report/2020/", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r = httptest.NewRequest("GET", tt.path, nil)
+		r.AddCookie(cookies[0])
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, tt.status, w.Code, tt.path)
+	}
+
+	// tokens are scoped to a dashboard
+	other := &Dash{Slug: "other", Config: s.config}
+	r = httptest.NewRequest("GET", "/other/"+"?"+u.RawQuery, nil)
+	w = httptest.NewRecorder()
+	s.acceptShareLinks(other)(s.requireAuth(echoUser())).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestShareCreateMaxTTL(t *testing.T) {
+	s := newTestServer()
+	s.config.ShareSecret = "share-secret"
+	s.config.ShareMaxTTL = 24 * time.Hour
+
+	r := httptest.NewRequest("POST", "/share?dashboard=report&ttl=48h", nil)
+	r = r.WithContext(withUser(r.Context(), &User{ID: "user-1", Method: "bearer"}))
+	w := httptest.NewRecorder()
+	s.shareCreate([]*Dash{{Slug: "report"}}).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestShareCreateRequiresBearer(t *testing.T) {
+	s := newTestServer()
+	s.config.ShareSecret = "share-secret"
+	s.config.ShareMaxTTL = 24 * time.Hour
+
+	r := httptest.NewRequest("POST", "/share?dashboard=report", nil)
+	r = r.WithContext(withUser(r.Context(), &User{ID: "user-1", Method: "session"}))
+	w := httptest.NewRecorder()
+	s.shareCreate([]*Dash{{Slug: "report"}}).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestSharePrefixMatches(t *testing.T) {
+	assert.True(t, sharePrefixMatches("reports/2021.html", ""))
+	assert.True(t, sharePrefixMatches("reports", "reports"))
+	assert.True(t, sharePrefixMatches("reports/2021.html", "reports"))
+	assert.True(t, sharePrefixMatches("reports/2021.html", "reports/"))
+	assert.False(t, sharePrefixMatches("reports-confidential/2021.html", "reports"))
+	assert.False(t, sharePrefixMatches("reports.html", "reports"))
+	assert.False(t, sharePrefixMatches("report", "reports"))
+}
+
+func TestShareKeyDerivedFromSessionSecret(t *testing.T) {
+	s := newTestServer()
+	assert.Empty(t, s.shareKey())
+
+	s.config.SessionSecret = "session-secret"
+	assert.Len(t, s.shareKey(), 32)
+	assert.NotEqual(t, []byte("session-secret"), s.shareKey())
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// staticPath is where the static assets are served on the base domain, out of
+// the way of dashboard slugs.
+const staticPath = "/.protodash/static/"
+
+// defaultAssets are the templates and static assets built into the binary,
+// PROTODASH_TEMPLATE_DIR can override any of them.
+//
+//go:embed templates/*.gohtml static
+var defaultAssets embed.FS
+
+// loadTemplates parses the built-in page templates, then the ones in dir which
+// replace the templates of the same file name.
+func loadTemplates(dir, baseDomain string) (*template.Template, error) {
+	tmpl := template.New("").Funcs(template.FuncMap{
+		"static": func(name string) string {
+			return "//" + baseDomain + staticPath + name
+		},
+	})
+
+	tmpl, err := tmpl.ParseFS(defaultAssets, "templates/*.gohtml")
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return tmpl, nil
+	}
+
+	overrides, err := filepath.Glob(filepath.Join(dir, "*.gohtml"))
+	if err != nil || len(overrides) == 0 {
+		return tmpl, err
+	}
+	return tmpl.ParseFiles(overrides...)
+}
+
+// overlayFS opens files from the first file system that has them.
+type overlayFS []fs.FS
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	for _, fsys := range o[:len(o)-1] {
+		if f, err := fsys.Open(name); err == nil {
+			return f, nil
+		}
+	}
+	return o[len(o)-1].Open(name)
+}
+
+// staticHandler serves the static assets from the static directory of dir,
+// falling back to the built-in ones.
+func staticHandler(dir string) http.Handler {
+	var fsys fs.FS
+	fsys, _ = fs.Sub(defaultAssets, "static")
+	if dir != "" {
+		fsys = overlayFS{os.DirFS(filepath.Join(dir, "static")), fsys}
+	}
+
+	files := http.StripPrefix(staticPath, http.FileServer(http.FS(fsys)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		files.ServeHTTP(w, r)
+	})
+}
+
+// renderPage renders the named template, answering with a plain 500 if it
+// fails so that a broken custom template doesn't send half a page.
+func (s *Server) renderPage(w http.ResponseWriter, status int, name string, data interface{}) {
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		log.Error().Err(err).Str("template", name).Send()
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+type errorPageData struct {
+	Status     int
+	StatusText string
+	BaseDomain string
+}
+
+// renderError answers with the error page to browsers and a plain text error
+// to other clients.
+func (s *Server) renderError(w http.ResponseWriter, r *http.Request, status int) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Error(w, fmt.Sprintf("%d %s", status, http.StatusText(status)), status)
+		return
+	}
+	s.renderPage(w, status, "error.gohtml", &errorPageData{
+		Status:     status,
+		StatusText: http.StatusText(status),
+		BaseDomain: s.config.BaseDomain,
+	})
+}
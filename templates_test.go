@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTemplatesOverride(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "error.gohtml"),
+		[]byte(`custom {{.Status}} <link href="{{static "brand.css"}}">`), 0644))
+
+	s := newTestServer()
+	tmpl, err := loadTemplates(dir, s.config.BaseDomain)
+	assert.NoError(t, err)
+	s.tmpl = tmpl
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	s.renderError(w, r, http.StatusForbidden)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, `custom 403 <link href="//example.com/.protodash/static/brand.css">`, w.Body.String())
+
+	// the other templates are still the built-in ones
+	assert.NotNil(t, tmpl.Lookup("index.gohtml"))
+	assert.NotNil(t, tmpl.Lookup("head"))
+}
+
+func TestRenderErrorPlainText(t *testing.T) {
+	s := newTestServer()
+	w := httptest.NewRecorder()
+	s.renderError(w, httptest.NewRequest("GET", "/", nil), http.StatusNotFound)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "404 Not Found\n", w.Body.String())
+}
+
+func TestRenderPageBrokenTemplate(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "login.gohtml"), []byte(`{{.Missing}}`), 0644))
+
+	s := newTestServer()
+	s.tmpl, _ = loadTemplates(dir, s.config.BaseDomain)
+	w := httptest.NewRecorder()
+	s.renderPage(w, http.StatusUnauthorized, "login.gohtml", struct{}{})
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestStaticHandler(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "static"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "static", "style.css"), []byte("body{}"), 0644))
+
+	tests := []struct {
+		dir    string
+		path   string
+		status int
+		body   string
+	}{
+		{"", "/.protodash/static/logo.svg", http.StatusOK, ""},
+		{"", "/.protodash/static/missing.css", http.StatusNotFound, ""},
+		{"", "/.protodash/static/", http.StatusNotFound, ""},
+		{dir, "/.protodash/static/style.css", http.StatusOK, "body{}"},
+		{dir, "/.protodash/static/logo.svg", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		staticHandler(tt.dir).ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		assert.Equal(t, tt.status, w.Code, tt.path)
+		if tt.body != "" {
+			assert.Equal(t, tt.body, w.Body.String())
+		}
+	}
+}
+
+func TestLoginInterstitial(t *testing.T) {
+	s := newTestServer()
+	s.config.OAuthEnabled = true
+
+	r := httptest.NewRequest("GET", "https://example.com/report/", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	s.requireAuth(echoUser()).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), `href="//example.com/auth/login?redirect_to=`)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxListPages caps the number of object listing pages read when looking for
+// the newest object under the prefix of a dashboard.
+const maxListPages = 10
+
+type updatedEntry struct {
+	updated time.Time
+	fetched time.Time
+}
+
+// updatedCache holds when the content of each dashboard last changed, keyed by
+// bucket and prefix so that it survives config reloads, and the fetches in
+// flight so that each key is only fetched once at a time.
+type updatedCache struct {
+	mu       sync.Mutex
+	entries  map[string]updatedEntry
+	fetching map[string]chan struct{}
+}
+
+// get returns the cached time of the key, whether there is one and whether it
+// is older than the ttl.
+func (c *updatedCache) get(key string, now time.Time, ttl time.Duration) (updated time.Time, ok, stale bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	return e.updated, ok, ok && now.Sub(e.fetched) >= ttl
+}
+
+func (c *updatedCache) set(key string, updated, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]updatedEntry)
+	}
+	c.entries[key] = updatedEntry{updated: updated, fetched: now}
+}
+
+// refresh fetches the key in the background unless it is already being
+// fetched, and returns a channel closed once the fetch is done. A failed fetch
+// keeps the previous time until the next refresh, one that timed out isn't
+// cached at all.
+func (c *updatedCache) refresh(key string, timeout time.Duration, fetch func(context.Context) (time.Time, error)) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if done, ok := c.fetching[key]; ok {
+		return done
+	}
+	if c.fetching == nil {
+		c.fetching = make(map[string]chan struct{})
+	}
+	done := make(chan struct{})
+	c.fetching[key] = done
+
+	go func() {
+		// the fetch is shared and outlives the request that started it
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		updated, err := fetch(ctx)
+		if err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("fetching last updated time")
+		}
+		if ctx.Err() == nil {
+			if err != nil {
+				c.mu.Lock()
+				updated = c.entries[key].updated
+				c.mu.Unlock()
+			}
+			c.set(key, updated, time.Now())
+		}
+
+		c.mu.Lock()
+		delete(c.fetching, key)
+		c.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+// lastUpdated returns when the content of each dashboard last changed, for
+// the dashboards where it is known. Stale times are served while they are
+// refreshed in the background, only the dashboards without one wait for GCS.
+func (s *Server) lastUpdated(ctx context.Context, dashboards []*Dash) map[string]time.Time {
+	updated := make(map[string]time.Time)
+	if s.config.LastUpdatedTTL <= 0 {
+		return updated
+	}
+
+	type pending struct {
+		slug, key string
+		done      <-chan struct{}
+	}
+	var waiting []pending
+	now := time.Now()
+	for _, d := range dashboards {
+		key := d.Bucket + "/" + d.Prefix
+		t, ok, stale := s.updated.get(key, now, s.config.LastUpdatedTTL)
+		if !ok || stale {
+			d := d
+			done := s.updated.refresh(key, s.config.ProxyTimeout, func(ctx context.Context) (time.Time, error) {
+				return d.lastUpdated(ctx, s.config.LastUpdatedFromPrefix)
+			})
+			if !ok {
+				waiting = append(waiting, pending{d.Slug, key, done})
+				continue
+			}
+		}
+		if !t.IsZero() {
+			updated[d.Slug] = t
+		}
+	}
+
+	for _, p := range waiting {
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			return updated
+		}
+		if t, _, _ := s.updated.get(p.key, now, s.config.LastUpdatedTTL); !t.IsZero() {
+			updated[p.slug] = t
+		}
+	}
+	return updated
+}
+
+// lastUpdated returns when the index object of the dashboard was last
+// updated, or with fromPrefix the newest object under its prefix.
+func (d *Dash) lastUpdated(ctx context.Context, fromPrefix bool) (time.Time, error) {
+	if fromPrefix {
+		return d.newestObject(ctx)
+	}
+
+	key := "index.html"
+	if d.Prefix != "" {
+		key = d.Prefix + "/" + key
+	}
+	resp, err := d.getObject(ctx, http.Header{}, http.MethodHead, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return http.ParseTime(resp.Header.Get("Last-Modified"))
+	case http.StatusNotFound:
+		return time.Time{}, nil
+	default:
+		return time.Time{}, fmt.Errorf("HEAD %s: %s", key, resp.Status)
+	}
+}
+
+// newestObject lists the objects under the prefix of the dashboard with the
+// GCS JSON API and returns the newest update time.
+func (d *Dash) newestObject(ctx context.Context) (time.Time, error) {
+	var (
+		newest    time.Time
+		pageToken string
+	)
+	for page := 0; page < maxListPages; page++ {
+		q := url.Values{"fields": {"items(updated),nextPageToken"}}
+		if d.Prefix != "" {
+			q.Set("prefix", d.Prefix+"/")
+		}
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		u := fmt.Sprintf("https://%s/storage/v1/b/%s/o?%s", gcsHost, url.PathEscape(d.Bucket), q.Encode())
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return newest, err
+		}
+		resp, err := d.Client.Do(req)
+		if err != nil {
+			return newest, err
+		}
+
+		var list struct {
+			Items []struct {
+				Updated time.Time `json:"updated"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return newest, fmt.Errorf("listing gs://%s/%s: %s", d.Bucket, d.Prefix, resp.Status)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return newest, err
+		}
+
+		for _, item := range list.Items {
+			if item.Updated.After(newest) {
+				newest = item.Updated
+			}
+		}
+		if list.NextPageToken == "" {
+			break
+		}
+		pageToken = list.NextPageToken
+	}
+	return newest, nil
+}
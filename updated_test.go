@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripFunc func(*http.Request) *http.Response
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r), nil
+}
+
+// fakeGCS returns a client answering every request with the handler and the
+// number of requests it made.
+func fakeGCS(h http.HandlerFunc) (*http.Client, *int32) {
+	var calls int32
+	return &http.Client{Transport: roundTripFunc(func(r *http.Request) *http.Response {
+		atomic.AddInt32(&calls, 1)
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w.Result()
+	})}, &calls
+}
+
+func TestLastUpdated(t *testing.T) {
+	modified := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	client, calls := fakeGCS(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		if r.URL.Path == "/reports/index.html" {
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	s := newTestServer()
+	s.config.LastUpdatedTTL = time.Minute
+	s.config.ProxyTimeout = time.Second
+	dashboards := []*Dash{
+		{Slug: "reports", Bucket: "b", Prefix: "reports", Client: client},
+		{Slug: "missing", Bucket: "b", Prefix: "missing", Client: client},
+	}
+
+	updated := s.lastUpdated(context.Background(), dashboards)
+	assert.Equal(t, map[string]time.Time{"reports": modified}, updated)
+	assert.Equal(t, int32(2), *calls)
+
+	// both results are cached, including the missing index
+	updated = s.lastUpdated(context.Background(), dashboards)
+	assert.Equal(t, map[string]time.Time{"reports": modified}, updated)
+	assert.Equal(t, int32(2), *calls)
+}
+
+func TestLastUpdatedFromPrefix(t *testing.T) {
+	client, _ := fakeGCS(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/storage/v1/b/b/o", r.URL.Path)
+		assert.Equal(t, "reports/", r.URL.Query().Get("prefix"))
+		if r.URL.Query().Get("pageToken") == "" {
+			w.Write([]byte(`{"items":[{"updated":"2021-03-04T05:06:07Z"}],"nextPageToken":"2"}`))
+			return
+		}
+		w.Write([]byte(`{"items":[{"updated":"2021-05-01T00:00:00Z"},{"updated":"2020-01-01T00:00:00Z"}]}`))
+	})
+
+	d := &Dash{Slug: "reports", Bucket: "b", Prefix: "reports", Client: client}
+	updated, err := d.lastUpdated(context.Background(), true)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC), updated)
+}
+
+func TestLastUpdatedDisabled(t *testing.T) {
+	s := newTestServer()
+	client, calls := fakeGCS(func(w http.ResponseWriter, r *http.Request) {})
+	updated := s.lastUpdated(context.Background(), []*Dash{{Slug: "a", Client: client}})
+	assert.Empty(t, updated)
+	assert.Equal(t, int32(0), *calls)
+}
+
+func TestIndexLastUpdated(t *testing.T) {
+	client, _ := fakeGCS(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", "Thu, 04 Mar 2021 05:06:07 GMT")
+	})
+
+	s := newTestServer()
+	s.config.LastUpdatedTTL = time.Minute
+	s.config.ProxyTimeout = time.Second
+	dashboards := []*Dash{{Name: "Report", Slug: "report", Public: true, Bucket: "b", Client: client}}
+
+	w := httptest.NewRecorder()
+	s.index(dashboards).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Contains(t, w.Body.String(), "updated Mar 4, 2021")
+}
+
+func TestLastUpdatedServesStale(t *testing.T) {
+	modified := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	release := make(chan struct{})
+	client, calls := fakeGCS(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	})
+
+	s := newTestServer()
+	s.config.LastUpdatedTTL = time.Minute
+	s.config.ProxyTimeout = time.Second
+	s.updated.set("b/reports", modified.Add(-time.Hour), time.Now().Add(-time.Hour))
+	dashboards := []*Dash{{Slug: "reports", Bucket: "b", Prefix: "reports", Client: client}}
+
+	// the stale time is served without waiting and refreshed only once
+	for i := 0; i < 3; i++ {
+		updated := s.lastUpdated(context.Background(), dashboards)
+		assert.Equal(t, map[string]time.Time{"reports": modified.Add(-time.Hour)}, updated)
+	}
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		updated, _, stale := s.updated.get("b/reports", time.Now(), time.Minute)
+		return updated.Equal(modified) && !stale
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestLastUpdatedSharesFetches(t *testing.T) {
+	var c updatedCache
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (time.Time, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return time.Unix(1, 0), nil
+	}
+
+	done := c.refresh("b/reports", time.Second, fetch)
+	assert.Equal(t, done, c.refresh("b/reports", time.Second, fetch))
+	close(release)
+	<-done
+
+	updated, ok, _ := c.get("b/reports", time.Now(), time.Minute)
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(1, 0), updated)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+}
+
+func TestLastUpdatedTimeoutNotCached(t *testing.T) {
+	client, calls := fakeGCS(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	s := newTestServer()
+	s.config.LastUpdatedTTL = time.Minute
+	s.config.ProxyTimeout = 10 * time.Millisecond
+	dashboards := []*Dash{{Slug: "reports", Bucket: "b", Prefix: "reports", Client: client}}
+
+	assert.Empty(t, s.lastUpdated(context.Background(), dashboards))
+	_, ok, _ := s.updated.get("b/reports", time.Now(), time.Minute)
+	assert.False(t, ok)
+
+	// the next request tries again
+	assert.Empty(t, s.lastUpdated(context.Background(), dashboards))
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestLastUpdatedCanceledRequest(t *testing.T) {
+	release := make(chan struct{})
+	client, _ := fakeGCS(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Last-Modified", "Thu, 04 Mar 2021 05:06:07 GMT")
+	})
+
+	s := newTestServer()
+	s.config.LastUpdatedTTL = time.Minute
+	s.config.ProxyTimeout = time.Second
+	dashboards := []*Dash{{Slug: "reports", Bucket: "b", Prefix: "reports", Client: client}}
+
+	// a canceled request stops waiting but the fetch still completes
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Empty(t, s.lastUpdated(ctx, dashboards))
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		_, ok, _ := s.updated.get("b/reports", time.Now(), time.Minute)
+		return ok
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+)
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	accessRecordContextKey
+)
+
+// User is the identity a request has been authenticated as.
+type User struct {
+	ID     string
+	Email  string
+	Groups []string
+	Method string
+	// Impersonator is the admin viewing the site as this user, if any, until
+	// ImpersonationEnds.
+	Impersonator      *User
+	ImpersonationEnds time.Time
+}
+
+// real returns the user behind an impersonation.
+func (u *User) real() *User {
+	if u.Impersonator != nil {
+		return u.Impersonator
+	}
+	return u
+}
+
+func (u *User) inGroup(group string) bool {
+	for _, g := range u.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+func withUser(ctx context.Context, u *User) context.Context {
+	return context.WithValue(ctx, userContextKey, u)
+}
+
+// userFromContext returns the user stored in the context by setUser.
+func userFromContext(ctx context.Context) *User {
+	u, _ := ctx.Value(userContextKey).(*User)
+	return u
+}
+
+// setUser returns the request with the user stored in its context and adds
+// the user to the request log.
+func setUser(r *http.Request, u *User) *http.Request {
+	hlog.FromRequest(r).UpdateContext(func(c zerolog.Context) zerolog.Context {
+		c = c.Str("user", u.ID).Str("auth_method", u.Method)
+		if u.Impersonator != nil {
+			c = c.Str("impersonator", u.Impersonator.ID)
+		}
+		return c
+	})
+	if rec := accessRecordFromContext(r.Context()); rec != nil {
+		rec.user = u
+	}
+	return r.WithContext(withUser(r.Context(), u))
+}
+
+// isAdmin returns whether the user is listed as an admin.
+func (s *Server) isAdmin(u *User) bool {
+	if u == nil || u.Email == "" {
+		return false
+	}
+	for _, admin := range s.config.Admins {
+		if strings.EqualFold(admin, u.Email) {
+			return true
+		}
+	}
+	return false
+}
+
+// canAccess returns whether the user may view the dashboard.
+func (s *Server) canAccess(d *Dash, u *User) bool {
+	ok, _ := s.accessDecision(d, u)
+	return ok
+}
+
+// accessDecision returns whether the user may view the dashboard and why.
+// Users limited to a single dashboard by basic auth or a share link have
+// already been checked by their middleware.
+func (s *Server) accessDecision(d *Dash, u *User) (bool, string) {
+	if d.Public {
+		return true, "public dashboard"
+	}
+	if !s.config.AuthEnabled() && d.BasicAuth == nil {
+		return true, "authentication disabled"
+	}
+	if u == nil {
+		return false, "not authenticated"
+	}
+	switch u.Method {
+	case "basic":
+		return true, "basic auth"
+	case "share":
+		return true, "share link"
+	}
+	if len(d.Groups) == 0 {
+		return true, "authenticated"
+	}
+	if s.isAdmin(u) {
+		return true, "admin"
+	}
+	for _, group := range d.Groups {
+		if u.inGroup(group) {
+			return true, "member of " + group
+		}
+	}
+	return false, "not a member of an allowed group"
+}
+
+// authorize rejects authenticated users that may not view the dashboard.
+func (s *Server) authorize(d *Dash) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, reason := s.accessDecision(d, userFromContext(r.Context()))
+			noteAccessReason(r, reason)
+			if !ok {
+				s.renderError(w, r, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
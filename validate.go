@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// configErrors collects every problem found in the dashboard config.
+type configErrors []error
+
+func (e configErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// dnsLabel matches slugs usable as a subdomain.
+var dnsLabel = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// pathSegment matches slugs usable as a path segment, which is all that
+// dashboards served on the base domain need.
+var pathSegment = regexp.MustCompile(`^[A-Za-z0-9_~-][A-Za-z0-9._~-]*$`)
+
+// notDNSLabel matches the runs of characters that aren't allowed in DNS
+// labels.
+var notDNSLabel = regexp.MustCompile(`[^a-z0-9]+`)
+
+// reservedSlugs are the first path segments of the routes of protodash on
+// the base domain, which dashboards and aliases can't use.
+var reservedSlugs = map[string]bool{
+	"admin": true,
+	"api":   true,
+	"auth":  true,
+	"share": true,
+}
+
+// hostname matches custom domains, with an optional port.
+var hostname = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(:[0-9]+)?$`)
+
+// validateSlug returns the problems of the slug or alias, which must be a DNS
+// label if it is used in hostnames and a path segment otherwise.
+func validateSlug(kind, slug string, hostnames bool) []string {
+	switch {
+	case hostnames && !dnsLabel.MatchString(slug):
+		return []string{fmt.Sprintf("%s %q must be a DNS label of lowercase letters, digits and hyphens on a dashboard with subdomain or domains, such as %q",
+			kind, slug, strings.Trim(notDNSLabel.ReplaceAllString(strings.ToLower(slug), "-"), "-"))}
+	case !pathSegment.MatchString(slug):
+		return []string{fmt.Sprintf(`%s %q must only contain letters, digits, "-", "_", "~" and "." and not start with "."`, kind, slug)}
+	case reservedSlugs[slug]:
+		return []string{fmt.Sprintf("%s %q is reserved", kind, slug)}
+	}
+	return nil
+}
+
+// validate returns the problems of the dashboard config.
+func (d *Dash) validate() []string {
+	var problems []string
+
+	// aliases that aren't DNS labels only redirect their path
+	problems = append(problems, validateSlug("slug", d.Slug, d.Subdomain || len(d.Domains) > 0)...)
+	for _, alias := range d.Aliases {
+		problems = append(problems, validateSlug("alias", alias, false)...)
+	}
+	for _, domain := range d.Domains {
+		if !hostname.MatchString(domain) {
+			problems = append(problems, fmt.Sprintf("domain %q must be a lowercase hostname, optionally with a port", domain))
+		} else if domain == d.Config.BaseDomain || strings.HasSuffix(domain, "."+d.Config.BaseDomain) {
+			problems = append(problems, fmt.Sprintf("domain %q is under the base domain, use subdomain instead", domain))
+		}
+	}
+	if d.Bucket == "" {
+		problems = append(problems, "gcs_bucket is not set and there is no default bucket")
+	}
+	if strings.HasPrefix(d.Prefix, "/") || strings.HasSuffix(d.Prefix, "/") {
+		problems = append(problems, fmt.Sprintf("prefix %q must not start or end with a slash", d.Prefix))
+	}
+	if d.Public && d.BasicAuth != nil {
+		problems = append(problems, "basic_auth can't be used on a public dashboard")
+	}
+	if d.Public && len(d.Groups) > 0 {
+		problems = append(problems, "groups can't be used on a public dashboard")
+	}
+	if d.BasicAuth != nil {
+		problems = append(problems, d.BasicAuth.validate()...)
+	}
+	if d.Contact != "" {
+		u, err := url.Parse(d.ContactURL())
+		if err != nil || (u.Scheme != "mailto" && u.Scheme != "http" && u.Scheme != "https") {
+			problems = append(problems, "contact must be an email address or an http(s) URL")
+		}
+	}
+
+	return problems
+}
+
+// validateCommand implements `protodash validate [config]`, checking the
+// dashboard config without resolving its references and secrets. It returns
+// the exit code.
+func validateCommand(cfg *Config, args []string) int {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "usage: protodash validate [config]")
+		return 2
+	}
+
+	name := cfg.ConfigFile
+	if len(args) == 1 {
+		name = args[0]
+	}
+
+	var gcs *http.Client
+	if strings.HasPrefix(name, "gs://") {
+		var err error
+		if gcs, err = cfg.HTTPClient(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	files, _, err := newConfigSource(name, gcs, &http.Client{Timeout: cfg.ClientTimeout}).fetch("")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	dashboards, err := decodeDashboards(files, cfg, &references{check: true})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("%s: %d dashboards are valid\n", name, len(dashboards))
+	return 0
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeDashboardsStrict(t *testing.T) {
+	files := []configFile{{name: "config.yml", data: []byte(`
+report:
+  gcs_bucket: report
+  single_page: true
+other:
+  gcs_bucket: other
+  prefix: /static/
+Bad_Slug:
+  public: true
+  subdomain: true
+  groups: [team-a]
+  aliases: [Old_Slug]
+Path_Slug:
+  gcs_bucket: path
+.protodash:
+  gcs_bucket: hidden
+api:
+  gcs_bucket: api
+  aliases: [auth, old-api]
+secret:
+  gcs_bucket: secret
+  basic_auth:
+    users: [alice:plaintext]
+`)}}
+
+	_, err := decodeDashboards(files, &Config{}, nil)
+	assert.IsType(t, configErrors{}, err)
+	assert.Equal(t, []string{
+		"config.yml: line 4: field single_page not found in type main.Dash",
+		"config.yml: dashboard .protodash: slug \".protodash\" must only contain letters, digits, \"-\", \"_\", \"~\" and \".\" and not start with \".\"",
+		"config.yml: dashboard Bad_Slug: slug \"Bad_Slug\" must be a DNS label of lowercase letters, digits and hyphens on a dashboard with subdomain or domains, such as \"bad-slug\"",
+		"config.yml: dashboard Bad_Slug: gcs_bucket is not set and there is no default bucket",
+		"config.yml: dashboard Bad_Slug: groups can't be used on a public dashboard",
+		"config.yml: dashboard api: slug \"api\" is reserved",
+		"config.yml: dashboard api: alias \"auth\" is reserved",
+		"config.yml: dashboard other: prefix \"/static/\" must not start or end with a slash",
+		"config.yml: dashboard secret: basic_auth user \"alice\" must be user:bcrypt-hash",
+	}, errorStrings(err.(configErrors)))
+}
+
+func TestDecodeDashboards(t *testing.T) {
+	files := []configFile{{name: "config.yml", data: []byte(`
+report:
+  title: Weekly Report
+  single_page_app: true
+  prefix: static/report
+  subdomain: true
+  expires_on: 2021-06-30
+`)}}
+
+	dashboards, err := decodeDashboards(files, &Config{DefaultBucket: "protodash"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, dashboards, 1)
+	assert.Equal(t, "protodash", dashboards[0].Bucket)
+	assert.Equal(t, "Weekly Report", dashboards[0].Name)
+	assert.Equal(t, time.Date(2021, 6, 30, 0, 0, 0, 0, time.UTC), dashboards[0].ExpiresOn)
+
+	// empty files define no dashboards
+	dashboards, err = decodeDashboards([]configFile{{name: "empty.yml"}}, &Config{}, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, dashboards)
+}
+
+func errorStrings(errs []error) []string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return msgs
+}